@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ssh-keyz/property-details/config"
+)
+
+func TestHandleConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.Upstreams.OpenCageAPIKey = "opencage-secret"
+	cfg.Admin.Token = "admin-secret"
+
+	server := &Server{config: cfg}
+	handler := requireAdmin(cfg.Admin.Token.Value(), server.handleConfig)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "no token", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", authorization: "Bearer guess", wantStatus: http.StatusUnauthorized},
+		{name: "wrong scheme", authorization: "Basic admin-secret", wantStatus: http.StatusUnauthorized},
+		{name: "valid token", authorization: "Bearer admin-secret", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			body := w.Body.String()
+			if strings.Contains(body, "opencage-secret") || strings.Contains(body, "admin-secret") {
+				t.Errorf("body = %s, want secrets redacted", body)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(body, `"opencage_api_key":"REDACTED"`) {
+				t.Errorf("body = %s, want the effective config", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ssh-keyz/property-details/property"
+)
+
+// maxBatchBodyBytes bounds a batch request body, whatever its address count
+const maxBatchBodyBytes = 1 << 20
+
+// batchWriteMargin is the time left after a batch times out for its
+// response to be written
+const batchWriteMargin = 10 * time.Second
+
+// ndjsonContentType is the media type of streamed batch results, one JSON
+// value per line
+const ndjsonContentType = "application/x-ndjson"
+
+// batchResult is the outcome of looking up the address at Index of a batch.
+// Status is the status a single lookup would have answered with; Error is
+// set instead of Property when it failed.
+type batchResult struct {
+	Index    int            `json:"index"`
+	Address  string         `json:"address"`
+	Status   int            `json:"status"`
+	Property *property.Info `json:"property,omitempty"`
+	Error    *problem       `json:"error,omitempty"`
+}
+
+// batchSummary totals the outcomes of a batch. Partial lookups are those
+// missing a section.
+type batchSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Partial   int `json:"partial"`
+	Failed    int `json:"failed"`
+}
+
+func (s *batchSummary) add(result batchResult) {
+	s.Total++
+	switch result.Status {
+	case http.StatusOK:
+		s.Succeeded++
+	case http.StatusPartialContent:
+		s.Partial++
+	default:
+		s.Failed++
+	}
+}
+
+// batchResponse lists the results in the order the addresses were given
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+	Summary batchSummary  `json:"summary"`
+}
+
+// handleBatch looks up a JSON array of addresses, answering with the result
+// or error of each. The batch as a whole succeeds even if every lookup fails.
+// Clients accepting NDJSON have the results streamed as they complete.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeProblem(w, newProblem(http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	stream := acceptsNDJSON(r)
+	maxSize := s.config.Batch.MaxSize
+	if stream {
+		maxSize = s.config.Batch.MaxStreamSize
+	}
+	addresses, p := readBatch(w, r, maxSize)
+	if p != nil {
+		writeProblem(w, p)
+		return
+	}
+	if stream {
+		s.streamBatch(w, r, addresses)
+		return
+	}
+
+	ctx, cancel := s.batchContext(w, r)
+	defer cancel()
+
+	response := batchResponse{Results: make([]batchResult, len(addresses))}
+	s.lookupBatch(ctx, addresses, func(result batchResult) {
+		response.Results[result.Index] = result
+		response.Summary.add(result)
+	})
+	// Nobody is left to read the response
+	if r.Context().Err() != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// streamBatch writes each result as a line of NDJSON as soon as it completes,
+// followed by a line with the summary. Once the client goes away the
+// remaining lookups are abandoned and nothing more is written.
+func (s *Server) streamBatch(w http.ResponseWriter, r *http.Request, addresses []string) {
+	ctx, cancel := s.batchContext(w, r)
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	writeLine := func(v any) error {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	err := rc.Flush()
+	if errors.Is(err, http.ErrNotSupported) {
+		err = nil
+	}
+
+	var summary batchSummary
+	s.lookupBatch(ctx, addresses, func(result batchResult) {
+		summary.add(result)
+		if err == nil {
+			err = writeLine(result)
+		}
+		if err != nil {
+			cancel()
+		}
+	})
+	if err != nil || r.Context().Err() != nil {
+		return
+	}
+	writeLine(struct {
+		Summary batchSummary `json:"summary"`
+	}{summary})
+}
+
+// acceptsNDJSON reports whether the client asked for NDJSON in its Accept
+// header, with a quality above zero if it gave one
+func acceptsNDJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil || mediaType != ndjsonContentType {
+				continue
+			}
+			q, ok := params["q"]
+			if !ok {
+				return true
+			}
+			if quality, err := strconv.ParseFloat(q, 64); err == nil && quality > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readBatch decodes the addresses of a batch request, of which there must be
+// between one and maxSize
+func readBatch(w http.ResponseWriter, r *http.Request, maxSize int) ([]string, *problem) {
+	body := http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)
+	dec := json.NewDecoder(body)
+
+	var addresses []string
+	err := dec.Decode(&addresses)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("unexpected data after the array")
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return nil, newProblem(http.StatusRequestEntityTooLarge, codeBatchTooLarge,
+			fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+	case err != nil:
+		return nil, newProblem(http.StatusBadRequest, codeMalformedBatch, "Request body must be a JSON array of address strings")
+	case len(addresses) == 0:
+		return nil, newProblem(http.StatusBadRequest, codeEmptyBatch, "At least one address is required")
+	case len(addresses) > maxSize:
+		return nil, newProblem(http.StatusRequestEntityTooLarge, codeBatchTooLarge,
+			fmt.Sprintf("Batch of %d addresses exceeds the limit of %d", len(addresses), maxSize))
+	}
+	return addresses, nil
+}
+
+// batchContext bounds a batch by the configured timeout. Since a batch may
+// run well past the server's write timeout, the response's write deadline is
+// moved to match.
+func (s *Server) batchContext(w http.ResponseWriter, r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(s.config.Batch.Timeout)
+	// Unsupported by some writers, such as test recorders, which have no
+	// deadline to extend
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + batchWriteMargin))
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// lookupBatch looks up addresses, running at most the configured number of
+// lookups at once. Every lookup goes through the same service, and so shares
+// its rate limits, caches and in-flight lookups with all other requests.
+// emit is called from the calling goroutine with each result as it
+// completes. Once ctx is done the remaining addresses fail straight away.
+func (s *Server) lookupBatch(ctx context.Context, addresses []string, emit func(batchResult)) {
+	indexes := make(chan int)
+	results := make(chan batchResult)
+
+	var wg sync.WaitGroup
+	for n := min(s.config.Batch.Concurrency, len(addresses)); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results <- s.lookupBatchItem(ctx, i, addresses[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range addresses {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		emit(result)
+	}
+}
+
+func (s *Server) lookupBatchItem(ctx context.Context, index int, address string) batchResult {
+	result := batchResult{Index: index, Address: address}
+
+	err := ctx.Err()
+	var info *property.Info
+	if err == nil {
+		info, err = s.service.GetInfoContext(ctx, address)
+	}
+	if err != nil {
+		result.Error = problemFor(err)
+		result.Status = result.Error.Status
+		return result
+	}
+
+	result.Property = info
+	result.Status = http.StatusOK
+	if !info.Complete() {
+		result.Status = http.StatusPartialContent
+	}
+	return result
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ssh-keyz/property-details/config"
+	"github.com/ssh-keyz/property-details/property"
+)
+
+// countingGeocoder records how many lookups run at once
+type countingGeocoder struct {
+	mu        sync.Mutex
+	active    int
+	maxActive int
+}
+
+func (g *countingGeocoder) Name() string { return "counting" }
+
+func (g *countingGeocoder) Geocode(ctx context.Context, address string) (*property.Coordinates, error) {
+	g.mu.Lock()
+	g.active++
+	g.maxActive = max(g.maxActive, g.active)
+	g.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	g.mu.Lock()
+	g.active--
+	g.mu.Unlock()
+	return &property.Coordinates{Lat: 37.42, Lon: -122.08}, nil
+}
+
+func newBatchServer(t *testing.T, batch config.Batch, opts ...property.Option) *Server {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Batch = batch
+	return &Server{service: newTestService(t, opts...), config: cfg}
+}
+
+func postBatch(server *Server, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.handleBatch(w, httptest.NewRequest(http.MethodPost, "/properties", strings.NewReader(body)))
+	return w
+}
+
+func TestHandleBatch(t *testing.T) {
+	server := newBatchServer(t, config.Default().Batch)
+	valid := "1600 Amphitheatre Parkway, Mountain View, CA 94043"
+
+	addresses, _ := json.Marshal([]string{valid, "Invalid Address", valid, ""})
+	w := postBatch(server, string(addresses))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	var response struct {
+		Results []struct {
+			Index    int            `json:"index"`
+			Address  string         `json:"address"`
+			Status   int            `json:"status"`
+			Property *property.Info `json:"property"`
+			Error    *problem       `json:"error"`
+		} `json:"results"`
+		Summary batchSummary `json:"summary"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	wantStatus := []int{http.StatusOK, http.StatusUnprocessableEntity, http.StatusOK, http.StatusUnprocessableEntity}
+	if len(response.Results) != len(wantStatus) {
+		t.Fatalf("got %d results, want %d", len(response.Results), len(wantStatus))
+	}
+	for i, result := range response.Results {
+		if result.Index != i || result.Status != wantStatus[i] {
+			t.Errorf("results[%d] = index %d, status %d; want index %d, status %d", i, result.Index, result.Status, i, wantStatus[i])
+		}
+		if ok := result.Status == http.StatusOK; ok != (result.Property != nil) || ok == (result.Error != nil) {
+			t.Errorf("results[%d] has property %v and error %v, want exactly one", i, result.Property != nil, result.Error)
+		}
+	}
+	if response.Results[0].Property.Coordinates == nil {
+		t.Error("results[0] has no coordinates")
+	}
+	if e := response.Results[1].Error; e == nil || e.Code != codeInvalidAddress {
+		t.Errorf("results[1].error = %+v, want code %q", e, codeInvalidAddress)
+	}
+
+	want := batchSummary{Total: 4, Succeeded: 2, Failed: 2}
+	if response.Summary != want {
+		t.Errorf("summary = %+v, want %+v", response.Summary, want)
+	}
+}
+
+func TestHandleBatchConcurrency(t *testing.T) {
+	geocoder := &countingGeocoder{}
+	server := newBatchServer(t, config.Batch{MaxSize: 20, Concurrency: 3, Timeout: config.Duration(time.Minute)},
+		property.WithGeocoder(geocoder))
+
+	var addresses []string
+	for i := 1; i <= 12; i++ {
+		addresses = append(addresses, fmt.Sprintf("%d Main Street, Springfield, IL 62701", i))
+	}
+	body, _ := json.Marshal(addresses)
+
+	w := postBatch(server, string(body))
+	var response batchResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Summary.Succeeded != len(addresses) {
+		t.Errorf("summary = %+v, want every lookup to succeed", response.Summary)
+	}
+	for i, result := range response.Results {
+		if result.Address != addresses[i] {
+			t.Errorf("results[%d].address = %q, want %q", i, result.Address, addresses[i])
+		}
+	}
+	if geocoder.maxActive > 3 {
+		t.Errorf("%d lookups ran at once, want at most 3", geocoder.maxActive)
+	}
+}
+
+func TestHandleBatchTimeout(t *testing.T) {
+	server := newBatchServer(t, config.Batch{MaxSize: 10, Concurrency: 1, Timeout: config.Duration(time.Nanosecond)})
+
+	w := postBatch(server, `["1600 Amphitheatre Parkway, Mountain View, CA 94043"]`)
+	var response batchResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if e := response.Results[0].Error; e == nil || e.Code != codeUpstreamTimeout {
+		t.Errorf("results[0].error = %+v, want code %q", e, codeUpstreamTimeout)
+	}
+}
+
+func TestHandleBatchErrors(t *testing.T) {
+	server := newBatchServer(t, config.Batch{MaxSize: 2, Concurrency: 1, Timeout: config.Duration(time.Minute)})
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "wrong method", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed, wantCode: codeMethodNotAllowed},
+		{name: "object", body: `{"addresses": ["a"]}`, wantStatus: http.StatusBadRequest, wantCode: codeMalformedBatch},
+		{name: "numbers", body: `[1, 2]`, wantStatus: http.StatusBadRequest, wantCode: codeMalformedBatch},
+		{name: "trailing data", body: `["a"] ["b"]`, wantStatus: http.StatusBadRequest, wantCode: codeMalformedBatch},
+		{name: "empty body", body: ``, wantStatus: http.StatusBadRequest, wantCode: codeMalformedBatch},
+		{name: "empty array", body: `[]`, wantStatus: http.StatusBadRequest, wantCode: codeEmptyBatch},
+		{name: "null", body: `null`, wantStatus: http.StatusBadRequest, wantCode: codeEmptyBatch},
+		{name: "too many addresses", body: `["a", "b", "c"]`, wantStatus: http.StatusRequestEntityTooLarge, wantCode: codeBatchTooLarge},
+		{name: "body too large", body: `["` + strings.Repeat("a", maxBatchBodyBytes) + `"]`, wantStatus: http.StatusRequestEntityTooLarge, wantCode: codeBatchTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			w := httptest.NewRecorder()
+			server.handleBatch(w, httptest.NewRequest(method, "/properties", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var p problem
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil || p.Code != tt.wantCode {
+				t.Errorf("problem = %+v (%v), want code %q", p, err, tt.wantCode)
+			}
+		})
+	}
+}
+
+// gatedGeocoder holds back lookups of addresses starting with "2 " until
+// release is closed, and reports lookups abandoned by their caller
+type gatedGeocoder struct {
+	release   chan struct{}
+	abandoned chan struct{}
+}
+
+func (g *gatedGeocoder) Name() string { return "gated" }
+
+func (g *gatedGeocoder) Geocode(ctx context.Context, address string) (*property.Coordinates, error) {
+	if strings.HasPrefix(address, "2 ") {
+		select {
+		case <-g.release:
+		case <-ctx.Done():
+			close(g.abandoned)
+			return nil, ctx.Err()
+		}
+	}
+	return &property.Coordinates{Lat: 37.42, Lon: -122.08}, nil
+}
+
+func streamBatch(t *testing.T, ctx context.Context, url string, addresses []string) *http.Response {
+	t.Helper()
+	body, _ := json.Marshal(addresses)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(body)))
+	req.Header.Set("Accept", "application/json;q=0.5, application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /properties error = %v", err)
+	}
+	return resp
+}
+
+func TestHandleBatchStream(t *testing.T) {
+	geocoder := &gatedGeocoder{release: make(chan struct{}), abandoned: make(chan struct{})}
+	server := newBatchServer(t, config.Batch{MaxSize: 2, MaxStreamSize: 10, Concurrency: 2, Timeout: config.Duration(time.Minute)},
+		property.WithGeocoder(geocoder))
+	ts := httptest.NewServer(http.HandlerFunc(server.handleBatch))
+	defer ts.Close()
+
+	// More addresses than a buffered batch may hold
+	resp := streamBatch(t, context.Background(), ts.URL, []string{
+		"2 Main Street, Springfield, IL 62701",
+		"1 Main Street, Springfield, IL 62701",
+		"Invalid Address",
+	})
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != ndjsonContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ndjsonContentType)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func(v any) {
+		t.Helper()
+		if !lines.Scan() {
+			t.Fatalf("stream ended early: %v", lines.Err())
+		}
+		if err := json.Unmarshal(lines.Bytes(), v); err != nil {
+			t.Fatalf("line %q: %v", lines.Text(), err)
+		}
+	}
+
+	// The first address is held back, so the others arrive before it
+	seen := make(map[int]int)
+	for i := 0; i < 2; i++ {
+		var result batchResult
+		next(&result)
+		seen[result.Index] = result.Status
+	}
+	if seen[1] != http.StatusOK || seen[2] != http.StatusUnprocessableEntity {
+		t.Errorf("first results = %v, want 1: 200 and 2: 422 streamed before 0 completes", seen)
+	}
+	close(geocoder.release)
+
+	var result batchResult
+	next(&result)
+	if result.Index != 0 || result.Status != http.StatusOK || result.Property == nil {
+		t.Errorf("last result = %+v, want address 0 found", result)
+	}
+
+	var summary struct {
+		Summary batchSummary `json:"summary"`
+	}
+	next(&summary)
+	if want := (batchSummary{Total: 3, Succeeded: 2, Failed: 1}); summary.Summary != want {
+		t.Errorf("summary = %+v, want %+v", summary.Summary, want)
+	}
+	if lines.Scan() {
+		t.Errorf("unexpected line after the summary: %s", lines.Text())
+	}
+}
+
+func TestHandleBatchStreamDisconnect(t *testing.T) {
+	geocoder := &gatedGeocoder{release: make(chan struct{}), abandoned: make(chan struct{})}
+	server := newBatchServer(t, config.Batch{MaxSize: 10, MaxStreamSize: 10, Concurrency: 1, Timeout: config.Duration(time.Minute)},
+		property.WithGeocoder(geocoder))
+
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		server.handleBatch(w, r)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resp := streamBatch(t, ctx, ts.URL, []string{
+		"2 Main Street, Springfield, IL 62701",
+		"3 Main Street, Springfield, IL 62701",
+	})
+	defer resp.Body.Close()
+	cancel()
+
+	for name, ch := range map[string]chan struct{}{"lookup": geocoder.abandoned, "handler": done} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s still running after the client went away", name)
+		}
+	}
+}
+
+func TestAcceptsNDJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "application/json", want: false},
+		{accept: "application/x-ndjson", want: true},
+		{accept: "application/json;q=0.9, Application/X-NDJSON", want: true},
+		{accept: "application/x-ndjson;q=0", want: false},
+		{accept: "application/x-ndjson;q=0.0", want: false},
+		{accept: "application/x-ndjson;q=0.000", want: false},
+		{accept: "application/x-ndjson;q=0.001", want: true},
+		{accept: "application/x-ndjson;q=high", want: false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/properties", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := acceptsNDJSON(r); got != tt.want {
+			t.Errorf("acceptsNDJSON(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Package config loads the server's configuration from defaults, a YAML or
+// JSON file, environment variables and command-line flags
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ssh-keyz/property-details/opencage"
+	"github.com/ssh-keyz/property-details/property"
+)
+
+// Config is the server's effective configuration
+type Config struct {
+	Server     Server     `json:"server" yaml:"server"`
+	Log        Log        `json:"log" yaml:"log"`
+	CORS       CORS       `json:"cors" yaml:"cors"`
+	Geocoder   string     `json:"geocoder" yaml:"geocoder"`
+	Upstreams  Upstreams  `json:"upstreams" yaml:"upstreams"`
+	Schools    Schools    `json:"schools" yaml:"schools"`
+	RateLimits RateLimits `json:"rate_limits" yaml:"rate_limits"`
+	Batch      Batch      `json:"batch" yaml:"batch"`
+	Cache      Cache      `json:"cache" yaml:"cache"`
+	Tracing    Tracing    `json:"tracing" yaml:"tracing"`
+	Readiness  Readiness  `json:"readiness" yaml:"readiness"`
+	Admin      Admin      `json:"admin" yaml:"admin"`
+
+	// Path is the config file the settings were read from, if any
+	Path string `json:"-" yaml:"-"`
+}
+
+// Server controls the listener, its connection timeouts and how long a
+// shutdown waits for in-flight requests. A zero connection timeout disables
+// it.
+type Server struct {
+	Addr              string   `json:"addr" yaml:"addr"`
+	ReadHeaderTimeout Duration `json:"read_header_timeout" yaml:"read_header_timeout"`
+	ReadTimeout       Duration `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout      Duration `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	ShutdownTimeout   Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+}
+
+// Log selects the log format, json or text, and the minimum level
+type Log struct {
+	Format string `json:"format" yaml:"format"`
+	Level  string `json:"level" yaml:"level"`
+}
+
+// CORS controls which browser origins may call the API. An allowed origin is
+// either exact, such as https://example.com, or a pattern with a single *
+// in the first label of the host, which matches one or more characters other
+// than a dot: https://*.example.com or https://app-*.example.com. A lone *
+// allows every origin, which cannot be combined with credentials. MaxAge is
+// how long browsers may cache a preflight response.
+type CORS struct {
+	AllowedOrigins   []string `json:"allowed_origins" yaml:"allowed_origins"`
+	AllowedMethods   []string `json:"allowed_methods" yaml:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers" yaml:"allowed_headers"`
+	MaxAge           Duration `json:"max_age" yaml:"max_age"`
+	AllowCredentials bool     `json:"allow_credentials" yaml:"allow_credentials"`
+}
+
+// Upstreams locates the upstream providers. Timeout bounds each upstream
+// request, including its retries.
+type Upstreams struct {
+	NominatimURL   string   `json:"nominatim_url" yaml:"nominatim_url"`
+	OpenCageURL    string   `json:"opencage_url" yaml:"opencage_url"`
+	OpenCageAPIKey Secret   `json:"opencage_api_key" yaml:"opencage_api_key"`
+	OverpassURL    string   `json:"overpass_url" yaml:"overpass_url"`
+	Timeout        Duration `json:"timeout" yaml:"timeout"`
+}
+
+// Schools controls the nearby school search
+type Schools struct {
+	RadiusMetres int `json:"radius_m" yaml:"radius_m"`
+}
+
+// RateLimits holds the token bucket for each provider, applied to the host
+// its endpoint is configured at. The defaults follow the usage policies of
+// the public instances.
+type RateLimits struct {
+	Nominatim RateLimit `json:"nominatim" yaml:"nominatim"`
+	OpenCage  RateLimit `json:"opencage" yaml:"opencage"`
+	Overpass  RateLimit `json:"overpass" yaml:"overpass"`
+}
+
+// RateLimit allows Rate requests per second, Burst of them back to back. A
+// zero Rate lifts the limit. FailFast rejects a request as soon as no token
+// is available instead of queueing it.
+type RateLimit struct {
+	Rate     float64 `json:"rate" yaml:"rate"`
+	Burst    int     `json:"burst" yaml:"burst"`
+	FailFast bool    `json:"fail_fast" yaml:"fail_fast"`
+}
+
+// Batch limits batch lookups. MaxSize caps the addresses in one request, or
+// MaxStreamSize when the results are streamed, and Concurrency the lookups
+// it runs at once; Timeout bounds the whole batch.
+type Batch struct {
+	MaxSize       int      `json:"max_size" yaml:"max_size"`
+	MaxStreamSize int      `json:"max_stream_size" yaml:"max_stream_size"`
+	Concurrency   int      `json:"concurrency" yaml:"concurrency"`
+	Timeout       Duration `json:"timeout" yaml:"timeout"`
+}
+
+// Cache optionally persists lookups to a file across restarts
+type Cache struct {
+	Path string `json:"path" yaml:"path"`
+}
+
+// Tracing selects the span exporter: none, stdout, or file, which appends to
+// File
+type Tracing struct {
+	Exporter string `json:"exporter" yaml:"exporter"`
+	File     string `json:"file" yaml:"file"`
+}
+
+// Readiness controls the background upstream probes behind /readyz. Zero
+// disables them.
+type Readiness struct {
+	ProbeInterval Duration `json:"probe_interval" yaml:"probe_interval"`
+}
+
+// Admin protects the admin endpoints, which are disabled without a token
+type Admin struct {
+	Token Secret `json:"token" yaml:"token"`
+}
+
+// maxSchoolRadius keeps Overpass queries within its default 25s budget
+const maxSchoolRadius = 50000
+
+// maxBatchSize bounds the results a batch response holds in memory, and
+// maxStreamSize keeps a streamed batch's request body within the server's
+// size limit
+const (
+	maxBatchSize  = 1000
+	maxStreamSize = 10000
+)
+
+// Default returns the configuration used when nothing is overridden
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Addr:              ":8080",
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			ReadTimeout:       Duration(10 * time.Second),
+			// Leaves a full lookup, which may take up to 40s when geocoding
+			// and schools both run to their stage deadlines, time to be written
+			WriteTimeout: Duration(60 * time.Second),
+			IdleTimeout:  Duration(120 * time.Second),
+			// Fits within Kubernetes' default 30s grace period
+			ShutdownTimeout: Duration(25 * time.Second),
+		},
+		Log: Log{Format: "json", Level: "info"},
+		CORS: CORS{
+			AllowedOrigins: []string{
+				"https://property-details-client.vercel.app",
+				"http://localhost:4321",
+			},
+			AllowedMethods: []string{http.MethodGet, http.MethodPost},
+			AllowedHeaders: []string{"Content-Type"},
+			MaxAge:         Duration(10 * time.Minute),
+		},
+		Geocoder: property.ProviderNominatim,
+		Upstreams: Upstreams{
+			NominatimURL: property.DefaultNominatimURL,
+			OpenCageURL:  opencage.DefaultBaseURL,
+			OverpassURL:  property.DefaultOverpassURL,
+			Timeout:      Duration(60 * time.Second),
+		},
+		Schools: Schools{RadiusMetres: property.DefaultSchoolRadius},
+		// The same limits as property.DefaultRateLimits
+		RateLimits: RateLimits{
+			Nominatim: RateLimit{Rate: 1, Burst: 1},
+			OpenCage:  RateLimit{Rate: 1, Burst: 1},
+			Overpass:  RateLimit{Rate: 1, Burst: 2},
+		},
+		Batch: Batch{
+			MaxSize:       100,
+			MaxStreamSize: 5000,
+			Concurrency:   4,
+			Timeout:       Duration(5 * time.Minute),
+		},
+		Tracing: Tracing{Exporter: "none"},
+	}
+}
+
+// Validate reports every invalid value at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr is required")
+	for _, d := range []struct {
+		name  string
+		value Duration
+	}{
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"upstreams.timeout", c.Upstreams.Timeout},
+		{"readiness.probe_interval", c.Readiness.ProbeInterval},
+	} {
+		check(d.value >= 0, "%s must not be negative, got %v", d.name, d.value)
+	}
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive, got %v", c.Server.ShutdownTimeout)
+
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format must be json or text, got %q", c.Log.Format)
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level must be debug, info, warn or error, got %q", c.Log.Level)
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(validOrigin(origin), "cors.allowed_origins: %q is not *, a scheme://host[:port] origin or a pattern with one * in the first host label", origin)
+		check(origin != "*" || !c.CORS.AllowCredentials, "cors.allowed_origins: * cannot be combined with cors.allow_credentials")
+	}
+	for _, method := range c.CORS.AllowedMethods {
+		check(validToken(method) && method == strings.ToUpper(method), "cors.allowed_methods: %q is not an upper-case HTTP method", method)
+	}
+	for _, header := range c.CORS.AllowedHeaders {
+		check(validToken(header), "cors.allowed_headers: %q is not a valid header name", header)
+	}
+	check(c.CORS.MaxAge >= 0, "cors.max_age must not be negative, got %v", c.CORS.MaxAge)
+
+	check(c.Geocoder == property.ProviderNominatim || c.Geocoder == property.ProviderOpenCage,
+		"geocoder must be nominatim or opencage, got %q", c.Geocoder)
+	for _, endpoint := range []struct {
+		name  string
+		value string
+	}{
+		{"upstreams.nominatim_url", c.Upstreams.NominatimURL},
+		{"upstreams.opencage_url", c.Upstreams.OpenCageURL},
+		{"upstreams.overpass_url", c.Upstreams.OverpassURL},
+	} {
+		check(validURL(endpoint.value), "%s must be an absolute http(s) URL, got %q", endpoint.name, endpoint.value)
+	}
+
+	check(c.Schools.RadiusMetres > 0 && c.Schools.RadiusMetres <= maxSchoolRadius,
+		"schools.radius_m must be between 1 and %d, got %d", maxSchoolRadius, c.Schools.RadiusMetres)
+
+	for _, limit := range []struct {
+		name  string
+		value RateLimit
+	}{
+		{"rate_limits.nominatim", c.RateLimits.Nominatim},
+		{"rate_limits.opencage", c.RateLimits.OpenCage},
+		{"rate_limits.overpass", c.RateLimits.Overpass},
+	} {
+		check(limit.value.Rate >= 0, "%s.rate must not be negative, got %v", limit.name, limit.value.Rate)
+		check(limit.value.Rate == 0 || limit.value.Burst > 0, "%s.burst must be positive, got %d", limit.name, limit.value.Burst)
+	}
+
+	check(c.Batch.MaxSize > 0 && c.Batch.MaxSize <= maxBatchSize,
+		"batch.max_size must be between 1 and %d, got %d", maxBatchSize, c.Batch.MaxSize)
+	check(c.Batch.MaxStreamSize > 0 && c.Batch.MaxStreamSize <= maxStreamSize,
+		"batch.max_stream_size must be between 1 and %d, got %d", maxStreamSize, c.Batch.MaxStreamSize)
+	check(c.Batch.Concurrency > 0, "batch.concurrency must be positive, got %d", c.Batch.Concurrency)
+	check(c.Batch.Timeout > 0, "batch.timeout must be positive, got %v", c.Batch.Timeout)
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "file":
+		check(c.Tracing.File != "", "tracing.file is required by the file exporter")
+	default:
+		check(false, "tracing.exporter must be none, stdout or file, got %q", c.Tracing.Exporter)
+	}
+
+	return errors.Join(errs...)
+}
+
+func validURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validOrigin(value string) bool {
+	if value == "*" {
+		return true
+	}
+
+	scheme, host, ok := strings.Cut(value, "://")
+	if !ok || (scheme != "http" && scheme != "https") || host == "" {
+		return false
+	}
+	// Only the first label of the host may hold a wildcard
+	if i := strings.IndexByte(host, '*'); i >= 0 {
+		firstLabel, rest, _ := strings.Cut(host, ".")
+		if strings.Count(firstLabel, "*") != 1 || strings.Contains(rest, "*") || rest == "" {
+			return false
+		}
+		host = strings.Replace(host, "*", "x", 1)
+	}
+
+	u, err := url.Parse(scheme + "://" + host)
+	return err == nil && u.Host == host && u.Hostname() != "" && u.User == nil
+}
+
+// validToken reports whether value is an RFC 9110 token, as used for method
+// and header names
+func validToken(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, c := range value {
+		if c > unicode.MaxASCII || !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
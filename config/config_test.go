@@ -0,0 +1,298 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func envFunc(env map[string]string) func(string) string {
+	return func(name string) string { return env[name] }
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, envFunc(nil))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Addr != ":8080" || cfg.Schools.RadiusMetres != 2000 || cfg.Upstreams.Timeout != Duration(60*time.Second) {
+		t.Errorf("Load() = %+v, want the defaults", cfg)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 2 {
+		t.Errorf("CORS.AllowedOrigins = %v, want the two default origins", cfg.CORS.AllowedOrigins)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+server:
+  addr: ":9000"
+  write_timeout: 90s
+cors:
+  allowed_origins: ["https://example.com"]
+schools:
+  radius_m: 1500
+rate_limits:
+  overpass:
+    rate: 0.5
+    burst: 3
+log:
+  level: warn
+`)
+
+	tests := []struct {
+		name  string
+		args  []string
+		env   map[string]string
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "file over defaults",
+			args: []string{"-config", yamlFile},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Server.Addr != ":9000" || cfg.Server.WriteTimeout != Duration(90*time.Second) || cfg.Schools.RadiusMetres != 1500 {
+					t.Errorf("Load() = %+v, want the file's values", cfg.Server)
+				}
+				if cfg.Server.ReadTimeout != Default().Server.ReadTimeout {
+					t.Errorf("Server.ReadTimeout = %v, want the default kept", cfg.Server.ReadTimeout)
+				}
+				if len(cfg.CORS.AllowedOrigins) != 1 || cfg.CORS.AllowedOrigins[0] != "https://example.com" {
+					t.Errorf("CORS.AllowedOrigins = %v, want the file's list", cfg.CORS.AllowedOrigins)
+				}
+				if cfg.Path != yamlFile {
+					t.Errorf("Path = %q, want %q", cfg.Path, yamlFile)
+				}
+			},
+		},
+		{
+			name: "file named by env",
+			env:  map[string]string{ConfigFileEnv: yamlFile},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Server.Addr != ":9000" {
+					t.Errorf("Server.Addr = %q, want the file's", cfg.Server.Addr)
+				}
+			},
+		},
+		{
+			name: "env over file",
+			args: []string{"-config", yamlFile},
+			env:  map[string]string{"ADDR": ":9100", "SCHOOL_RADIUS": "800", "CORS_ALLOWED_ORIGINS": "https://a.example.com, https://b.example.com"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Server.Addr != ":9100" || cfg.Schools.RadiusMetres != 800 || len(cfg.CORS.AllowedOrigins) != 2 {
+					t.Errorf("Load() = %+v, %+v, %v, want env values", cfg.Server, cfg.Schools, cfg.CORS.AllowedOrigins)
+				}
+				if want := (RateLimit{Rate: 0.5, Burst: 3}); cfg.RateLimits.Overpass != want {
+					t.Errorf("RateLimits.Overpass = %+v, want the file's %+v", cfg.RateLimits.Overpass, want)
+				}
+				if cfg.Log.Level != "warn" {
+					t.Errorf("Log.Level = %q, want the file's value where env is unset", cfg.Log.Level)
+				}
+			},
+		},
+		{
+			name: "flags over env",
+			args: []string{"-config", yamlFile, "-addr", ":9200", "-opencage-api-key", "flag-key", "-overpass-rate-limit", "2", "-nominatim-rate-fail-fast"},
+			env:  map[string]string{"ADDR": ":9100", "OPENCAGE_API_KEY": "env-key", "OVERPASS_RATE_LIMIT": "0.25", "OVERPASS_RATE_BURST": "4"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Server.Addr != ":9200" || cfg.Upstreams.OpenCageAPIKey.Value() != "flag-key" {
+					t.Errorf("Load() addr = %q, key = %q, want the flags'", cfg.Server.Addr, cfg.Upstreams.OpenCageAPIKey.Value())
+				}
+				if want := (RateLimit{Rate: 2, Burst: 4}); cfg.RateLimits.Overpass != want {
+					t.Errorf("RateLimits.Overpass = %+v, want %+v from the flag and env", cfg.RateLimits.Overpass, want)
+				}
+				if !cfg.RateLimits.Nominatim.FailFast {
+					t.Error("RateLimits.Nominatim.FailFast = false, want the flag's true")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(tt.args, envFunc(tt.env))
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	path := writeFile(t, "config.json", `{"upstreams": {"timeout": "15s", "opencage_api_key": "file-key"}, "geocoder": "opencage"}`)
+
+	cfg, err := Load([]string{"-config", path}, envFunc(nil))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Upstreams.Timeout != Duration(15*time.Second) || cfg.Upstreams.OpenCageAPIKey.Value() != "file-key" || cfg.Geocoder != "opencage" {
+		t.Errorf("Load() = %+v, want the file's values", cfg.Upstreams)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		args    []string
+		env     map[string]string
+		want    string
+	}{
+		{name: "unknown file key", file: "config.yaml", content: "server:\n  port: 8080\n", want: "field port not found"},
+		{name: "unknown json key", file: "config.json", content: `{"sever": {}}`, want: `unknown field "sever"`},
+		{name: "unsupported format", file: "config.toml", content: "", want: "unsupported format"},
+		{name: "malformed env", env: map[string]string{"UPSTREAM_TIMEOUT": "10"}, want: "invalid UPSTREAM_TIMEOUT"},
+		{name: "malformed flag", args: []string{"-school-radius", "wide"}, want: "invalid integer"},
+		{name: "malformed rate", env: map[string]string{"NOMINATIM_RATE_LIMIT": "1/s"}, want: "invalid number"},
+		{name: "unknown flag", args: []string{"-port", "8080"}, want: "flag provided but not defined"},
+		{name: "invalid value", env: map[string]string{"GEOCODER": "google"}, want: "geocoder must be nominatim or opencage"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file, tt.content)}, args...)
+			}
+			_, err := loadQuietly(args, envFunc(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// loadQuietly is Load without the usage the flag package prints on errors
+func loadQuietly(args []string, getenv func(string) string) (*Config, error) {
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+	return Load(args, getenv)
+}
+
+func TestLoadHelp(t *testing.T) {
+	if _, err := loadQuietly([]string{"-h"}, envFunc(nil)); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Load(-h) error = %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Server.ShutdownTimeout = 0
+	cfg.Upstreams.OverpassURL = "overpass-api.de/api/interpreter"
+	cfg.Schools.RadiusMetres = 0
+	cfg.CORS.AllowedOrigins = []string{"https://example.com/app"}
+	cfg.Tracing.Exporter = "file"
+	cfg.Batch.MaxSize = 5000
+	cfg.RateLimits.Nominatim.Rate = -1
+	cfg.RateLimits.Overpass.Burst = 0
+
+	err := cfg.Validate()
+	for _, want := range []string{
+		"server.shutdown_timeout",
+		"upstreams.overpass_url",
+		"schools.radius_m",
+		"cors.allowed_origins",
+		"tracing.file",
+		"batch.max_size",
+		"rate_limits.nominatim.rate",
+		"rate_limits.overpass.burst",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestValidateCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		methods     []string
+		headers     []string
+		credentials bool
+		wantErr     bool
+	}{
+		{name: "exact", origins: []string{"https://example.com", "http://localhost:4321"}},
+		{name: "subdomain pattern", origins: []string{"https://*.example.com"}},
+		{name: "label pattern", origins: []string{"https://app-*-team.vercel.app:8443"}},
+		{name: "any origin", origins: []string{"*"}},
+		{name: "any origin with credentials", origins: []string{"*"}, credentials: true, wantErr: true},
+		{name: "path", origins: []string{"https://example.com/"}, wantErr: true},
+		{name: "no scheme", origins: []string{"example.com"}, wantErr: true},
+		{name: "wildcard past the first label", origins: []string{"https://app.*.example.com"}, wantErr: true},
+		{name: "two wildcards", origins: []string{"https://*-*.example.com"}, wantErr: true},
+		{name: "bare wildcard host", origins: []string{"https://*"}, wantErr: true},
+		{name: "lower-case method", methods: []string{"get"}, wantErr: true},
+		{name: "header with space", headers: []string{"X Request"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			if tt.origins != nil {
+				cfg.CORS.AllowedOrigins = tt.origins
+			}
+			if tt.methods != nil {
+				cfg.CORS.AllowedMethods = tt.methods
+			}
+			if tt.headers != nil {
+				cfg.CORS.AllowedHeaders = tt.headers
+			}
+			cfg.CORS.AllowCredentials = tt.credentials
+
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBoolFlag(t *testing.T) {
+	cfg, err := Load([]string{"-cors-allow-credentials"}, envFunc(nil))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !cfg.CORS.AllowCredentials {
+		t.Error("CORS.AllowCredentials = false, want true from a bare flag")
+	}
+}
+
+func TestSecretRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Upstreams.OpenCageAPIKey = "super-secret"
+
+	encoded, _ := json.Marshal(cfg)
+	var buf strings.Builder
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("config", "key", cfg.Upstreams.OpenCageAPIKey)
+
+	for name, out := range map[string]string{
+		"json": string(encoded),
+		"fmt":  fmt.Sprintf("%v %+v", cfg.Upstreams.OpenCageAPIKey, cfg.Upstreams),
+		"slog": buf.String(),
+	} {
+		if strings.Contains(out, "super-secret") || !strings.Contains(out, redacted) {
+			t.Errorf("%s output = %s, want the key redacted", name, out)
+		}
+	}
+	if cfg.Upstreams.OpenCageAPIKey.Value() != "super-secret" {
+		t.Errorf("Value() = %q, want the key", cfg.Upstreams.OpenCageAPIKey.Value())
+	}
+}
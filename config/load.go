@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the config file when the -config flag is not given
+const ConfigFileEnv = "CONFIG_FILE"
+
+// setting is one value that can be overridden by an environment variable and
+// a flag
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	value func(*Config) flag.Value
+}
+
+var settings = []setting{
+	{"ADDR", "addr", "listen address", func(c *Config) flag.Value { return stringValue{&c.Server.Addr} }},
+	{"HTTP_READ_HEADER_TIMEOUT", "read-header-timeout", "time allowed to read request headers", func(c *Config) flag.Value { return durationValue{&c.Server.ReadHeaderTimeout} }},
+	{"HTTP_READ_TIMEOUT", "read-timeout", "time allowed to read a whole request", func(c *Config) flag.Value { return durationValue{&c.Server.ReadTimeout} }},
+	{"HTTP_WRITE_TIMEOUT", "write-timeout", "time allowed to write a response", func(c *Config) flag.Value { return durationValue{&c.Server.WriteTimeout} }},
+	{"HTTP_IDLE_TIMEOUT", "idle-timeout", "time an idle keep-alive connection is kept open", func(c *Config) flag.Value { return durationValue{&c.Server.IdleTimeout} }},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "time allowed for in-flight requests to finish on shutdown", func(c *Config) flag.Value { return durationValue{&c.Server.ShutdownTimeout} }},
+	{"LOG_FORMAT", "log-format", "log format: json or text", func(c *Config) flag.Value { return stringValue{&c.Log.Format} }},
+	{"LOG_LEVEL", "log-level", "minimum log level: debug, info, warn or error", func(c *Config) flag.Value { return stringValue{&c.Log.Level} }},
+	{"CORS_ALLOWED_ORIGINS", "cors-allowed-origins", "comma-separated origins allowed to call the property endpoints", func(c *Config) flag.Value { return listValue{&c.CORS.AllowedOrigins} }},
+	{"CORS_ALLOWED_METHODS", "cors-allowed-methods", "comma-separated methods allowed in cross-origin requests", func(c *Config) flag.Value { return listValue{&c.CORS.AllowedMethods} }},
+	{"CORS_ALLOWED_HEADERS", "cors-allowed-headers", "comma-separated request headers allowed in cross-origin requests", func(c *Config) flag.Value { return listValue{&c.CORS.AllowedHeaders} }},
+	{"CORS_MAX_AGE", "cors-max-age", "time browsers may cache a preflight response", func(c *Config) flag.Value { return durationValue{&c.CORS.MaxAge} }},
+	{"CORS_ALLOW_CREDENTIALS", "cors-allow-credentials", "allow cross-origin requests with cookies or HTTP authentication", func(c *Config) flag.Value { return boolValue{&c.CORS.AllowCredentials} }},
+	{"GEOCODER", "geocoder", "geocoding provider: nominatim or opencage", func(c *Config) flag.Value { return stringValue{&c.Geocoder} }},
+	{"NOMINATIM_URL", "nominatim-url", "Nominatim search endpoint", func(c *Config) flag.Value { return stringValue{&c.Upstreams.NominatimURL} }},
+	{"OPENCAGE_URL", "opencage-url", "OpenCage geocoding endpoint", func(c *Config) flag.Value { return stringValue{&c.Upstreams.OpenCageURL} }},
+	{"OPENCAGE_API_KEY", "opencage-api-key", "OpenCage API key", func(c *Config) flag.Value { return secretValue{&c.Upstreams.OpenCageAPIKey} }},
+	{"OVERPASS_URL", "overpass-url", "Overpass interpreter endpoint", func(c *Config) flag.Value { return stringValue{&c.Upstreams.OverpassURL} }},
+	{"UPSTREAM_TIMEOUT", "upstream-timeout", "time allowed for each upstream request, including retries", func(c *Config) flag.Value { return durationValue{&c.Upstreams.Timeout} }},
+	{"SCHOOL_RADIUS", "school-radius", "school search radius in metres", func(c *Config) flag.Value { return intValue{&c.Schools.RadiusMetres} }},
+	{"NOMINATIM_RATE_LIMIT", "nominatim-rate-limit", "Nominatim requests per second; 0 lifts the limit", func(c *Config) flag.Value { return floatValue{&c.RateLimits.Nominatim.Rate} }},
+	{"NOMINATIM_RATE_BURST", "nominatim-rate-burst", "Nominatim requests that may be sent back to back", func(c *Config) flag.Value { return intValue{&c.RateLimits.Nominatim.Burst} }},
+	{"NOMINATIM_RATE_FAIL_FAST", "nominatim-rate-fail-fast", "reject Nominatim requests over the rate limit instead of queueing them", func(c *Config) flag.Value { return boolValue{&c.RateLimits.Nominatim.FailFast} }},
+	{"OPENCAGE_RATE_LIMIT", "opencage-rate-limit", "OpenCage requests per second; 0 lifts the limit", func(c *Config) flag.Value { return floatValue{&c.RateLimits.OpenCage.Rate} }},
+	{"OPENCAGE_RATE_BURST", "opencage-rate-burst", "OpenCage requests that may be sent back to back", func(c *Config) flag.Value { return intValue{&c.RateLimits.OpenCage.Burst} }},
+	{"OPENCAGE_RATE_FAIL_FAST", "opencage-rate-fail-fast", "reject OpenCage requests over the rate limit instead of queueing them", func(c *Config) flag.Value { return boolValue{&c.RateLimits.OpenCage.FailFast} }},
+	{"OVERPASS_RATE_LIMIT", "overpass-rate-limit", "Overpass requests per second; 0 lifts the limit", func(c *Config) flag.Value { return floatValue{&c.RateLimits.Overpass.Rate} }},
+	{"OVERPASS_RATE_BURST", "overpass-rate-burst", "Overpass requests that may be sent back to back", func(c *Config) flag.Value { return intValue{&c.RateLimits.Overpass.Burst} }},
+	{"OVERPASS_RATE_FAIL_FAST", "overpass-rate-fail-fast", "reject Overpass requests over the rate limit instead of queueing them", func(c *Config) flag.Value { return boolValue{&c.RateLimits.Overpass.FailFast} }},
+	{"BATCH_MAX_SIZE", "batch-max-size", "most addresses accepted in one batch request", func(c *Config) flag.Value { return intValue{&c.Batch.MaxSize} }},
+	{"BATCH_MAX_STREAM_SIZE", "batch-max-stream-size", "most addresses accepted in one streamed batch request", func(c *Config) flag.Value { return intValue{&c.Batch.MaxStreamSize} }},
+	{"BATCH_CONCURRENCY", "batch-concurrency", "lookups a batch request runs at once", func(c *Config) flag.Value { return intValue{&c.Batch.Concurrency} }},
+	{"BATCH_TIMEOUT", "batch-timeout", "time allowed for a whole batch request", func(c *Config) flag.Value { return durationValue{&c.Batch.Timeout} }},
+	{"PROPERTY_CACHE_PATH", "cache-path", "file to persist lookups to across restarts", func(c *Config) flag.Value { return stringValue{&c.Cache.Path} }},
+	{"TRACE_EXPORTER", "trace-exporter", "span exporter: none, stdout or file", func(c *Config) flag.Value { return stringValue{&c.Tracing.Exporter} }},
+	{"TRACE_FILE", "trace-file", "file the file span exporter appends to", func(c *Config) flag.Value { return stringValue{&c.Tracing.File} }},
+	{"READINESS_PROBE_INTERVAL", "readiness-probe-interval", "interval between upstream reachability probes; 0 disables them", func(c *Config) flag.Value { return durationValue{&c.Readiness.ProbeInterval} }},
+	{"ADMIN_TOKEN", "admin-token", "bearer token for the admin endpoints, which are disabled without one", func(c *Config) flag.Value { return secretValue{&c.Admin.Token} }},
+}
+
+// Load builds the effective configuration. Defaults are overridden by the
+// file named by the -config flag or CONFIG_FILE, then by environment
+// variables, then by flags. The result is validated. With -h the usage is
+// printed and flag.ErrHelp returned.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	fs := flag.NewFlagSet("property-details", flag.ContinueOnError)
+	path := fs.String("config", "", "YAML or JSON config file (env "+ConfigFileEnv+")")
+
+	// Flags are parsed first, to find the config file, but applied last.
+	// Parsing into a scratch config reports malformed values straight away.
+	scratch := Default()
+	raw := make(map[string]string)
+	for _, s := range settings {
+		fs.Var(recordedValue{s.value(scratch), s.flag, raw}, s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	cfg := Default()
+	if *path == "" {
+		*path = getenv(ConfigFileEnv)
+	}
+	if *path != "" {
+		if err := loadFile(*path, cfg); err != nil {
+			return nil, err
+		}
+		cfg.Path = *path
+	}
+
+	for _, s := range settings {
+		if value := getenv(s.env); value != "" {
+			if err := s.value(cfg).Set(value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := raw[s.flag]; ok {
+			if err := s.value(cfg).Set(value); err != nil {
+				return nil, fmt.Errorf("invalid -%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// recordedValue keeps the raw text of each flag given, since a Secret's
+// String never returns it
+type recordedValue struct {
+	flag.Value
+	name string
+	raw  map[string]string
+}
+
+func (v recordedValue) Set(s string) error {
+	v.raw[v.name] = s
+	return v.Value.Set(s)
+}
+
+// IsBoolFlag passes through whether the wrapped flag may be given without a
+// value
+func (v recordedValue) IsBoolFlag() bool {
+	b, ok := v.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// loadFile overrides cfg with the settings in a .yaml, .yml or .json file.
+// Unknown keys are rejected so that typos do not go unnoticed.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(cfg); errors.Is(err, io.EOF) {
+			// An empty file overrides nothing
+			err = nil
+		}
+	default:
+		return fmt.Errorf("config file %s: unsupported format, want .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
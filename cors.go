@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ssh-keyz/property-details/config"
+)
+
+// originPattern matches origins whose first host label has a fixed prefix
+// and suffix around a wildcard, which stands for one or more characters other
+// than a dot
+type originPattern struct {
+	scheme string
+	prefix string
+	suffix string
+	port   string
+}
+
+func (p originPattern) match(u *url.URL) bool {
+	host := u.Hostname()
+	return u.Scheme == p.scheme && u.Port() == p.port &&
+		len(host) > len(p.prefix)+len(p.suffix) &&
+		strings.HasPrefix(host, p.prefix) && strings.HasSuffix(host, p.suffix) &&
+		!strings.Contains(host[len(p.prefix):len(host)-len(p.suffix)], ".")
+}
+
+// corsPolicy decides which cross-origin requests browsers may make, built
+// from a validated config.CORS
+type corsPolicy struct {
+	anyOrigin    bool
+	origins      map[string]bool
+	patterns     []originPattern
+	methods      map[string]bool
+	headers      map[string]bool
+	allowMethods string
+	allowHeaders string
+	maxAge       string
+	credentials  bool
+}
+
+func newCORSPolicy(cfg config.CORS) *corsPolicy {
+	p := &corsPolicy{
+		origins:     make(map[string]bool),
+		methods:     make(map[string]bool),
+		headers:     make(map[string]bool),
+		credentials: cfg.AllowCredentials,
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			scheme, host, _ := strings.Cut(origin, "://")
+			hostname, port := host, ""
+			if i := strings.LastIndexByte(host, ':'); i >= 0 {
+				hostname, port = host[:i], host[i+1:]
+			}
+			prefix, suffix, _ := strings.Cut(hostname, "*")
+			p.patterns = append(p.patterns, originPattern{scheme: scheme, prefix: prefix, suffix: suffix, port: port})
+		default:
+			p.origins[origin] = true
+		}
+	}
+
+	var methods []string
+	for _, method := range cfg.AllowedMethods {
+		if !p.methods[method] {
+			p.methods[method] = true
+			methods = append(methods, method)
+		}
+	}
+	p.allowMethods = strings.Join(methods, ", ")
+
+	for _, header := range cfg.AllowedHeaders {
+		p.headers[strings.ToLower(header)] = true
+	}
+	p.allowHeaders = strings.Join(cfg.AllowedHeaders, ", ")
+
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(time.Duration(cfg.MaxAge) / time.Second))
+	}
+	return p
+}
+
+// allowOrigin reports whether origin may make cross-origin requests
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.anyOrigin || p.origins[origin] {
+		return true
+	}
+	if len(p.patterns) == 0 {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || u.Path != "" || u.User != nil {
+		return false
+	}
+	for _, pattern := range p.patterns {
+		if pattern.match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowRequestHeaders reports whether every header named in a preflight's
+// Access-Control-Request-Headers is allowed
+func (p *corsPolicy) allowRequestHeaders(requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header != "" && !p.headers[header] {
+			return false
+		}
+	}
+	return true
+}
+
+// setOrigin allows origin to read the response, and its timing through the
+// browser's performance API
+func (p *corsPolicy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin && !p.credentials {
+		origin = "*"
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Timing-Allow-Origin", origin)
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// corsMiddleware applies policy to next. Preflight requests are answered
+// here; other requests, including OPTIONS requests that are not preflights,
+// go on to next. Responses that depend on the Origin header say so in Vary,
+// so that caches keep them apart.
+func corsMiddleware(policy *corsPolicy, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if !policy.anyOrigin || policy.credentials {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			if policy.allowOrigin(origin) &&
+				policy.methods[r.Header.Get("Access-Control-Request-Method")] &&
+				policy.allowRequestHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+				policy.setOrigin(w.Header(), origin)
+				w.Header().Set("Access-Control-Allow-Methods", policy.allowMethods)
+				if policy.allowHeaders != "" {
+					w.Header().Set("Access-Control-Allow-Headers", policy.allowHeaders)
+				}
+				if policy.maxAge != "" {
+					w.Header().Set("Access-Control-Max-Age", policy.maxAge)
+				}
+			}
+			// A preflight without CORS headers is refused by the browser
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if policy.allowOrigin(origin) {
+			policy.setOrigin(w.Header(), origin)
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ssh-keyz/property-details/config"
+)
+
+func TestCORSPolicyAllowOrigin(t *testing.T) {
+	policy := newCORSPolicy(config.CORS{
+		AllowedOrigins: []string{
+			"https://property-details-client.vercel.app",
+			"https://property-details-client-*-ssh-keyz.vercel.app",
+			"https://*.example.com",
+			"http://*.localhost:4321",
+		},
+	})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "https://property-details-client.vercel.app", want: true},
+		{origin: "https://property-details-client-git-main-ssh-keyz.vercel.app", want: true},
+		{origin: "https://property-details-client-3f9a1c-ssh-keyz.vercel.app", want: true},
+		{origin: "https://app.example.com", want: true},
+		{origin: "http://preview.localhost:4321", want: true},
+		{origin: "", want: false},
+		{origin: "null", want: false},
+		{origin: "http://property-details-client.vercel.app", want: false},
+		{origin: "https://property-details-client-x-attacker.vercel.app", want: false},
+		{origin: "https://property-details-client--ssh-keyz.vercel.app", want: false},
+		{origin: "https://example.com", want: false},
+		{origin: "https://a.b.example.com", want: false},
+		{origin: "https://app.example.com.evil.com", want: false},
+		{origin: "https://app.example.com:8443", want: false},
+		{origin: "http://preview.localhost", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := policy.allowOrigin(tt.origin); got != tt.want {
+			t.Errorf("allowOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	base := config.CORS{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.preview.example.com"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders: []string{"Content-Type", "X-Request-ID"},
+		MaxAge:         config.Duration(10 * time.Minute),
+	}
+	withCredentials := base
+	withCredentials.AllowCredentials = true
+	anyOrigin := base
+	anyOrigin.AllowedOrigins = []string{"*"}
+
+	tests := []struct {
+		name       string
+		cfg        config.CORS
+		method     string
+		header     map[string]string
+		wantStatus int
+		wantNext   bool
+		want       map[string]string
+		wantVary   []string
+	}{
+		{
+			name:       "allowed origin",
+			cfg:        base,
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Timing-Allow-Origin":              "https://app.example.com",
+				"Access-Control-Allow-Credentials": "",
+			},
+			wantVary: []string{"Origin"},
+		},
+		{
+			name:       "pattern origin",
+			cfg:        base,
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://pr-42.preview.example.com"},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			want:       map[string]string{"Access-Control-Allow-Origin": "https://pr-42.preview.example.com"},
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "disallowed origin still varies",
+			cfg:        base,
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://evil.example.org"},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			want:       map[string]string{"Access-Control-Allow-Origin": ""},
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "same-origin request",
+			cfg:        base,
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			want:       map[string]string{"Access-Control-Allow-Origin": ""},
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:   "preflight",
+			cfg:    base,
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": "content-type, x-request-id",
+			},
+			wantStatus: http.StatusNoContent,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Content-Type, X-Request-ID",
+				"Access-Control-Max-Age":       "600",
+			},
+			wantVary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:   "preflight for a disallowed method",
+			cfg:    base,
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": http.MethodDelete,
+			},
+			wantStatus: http.StatusNoContent,
+			want:       map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+			wantVary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:   "preflight for a disallowed header",
+			cfg:    base,
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodGet,
+				"Access-Control-Request-Headers": "Authorization",
+			},
+			wantStatus: http.StatusNoContent,
+			want:       map[string]string{"Access-Control-Allow-Origin": ""},
+			wantVary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:   "preflight from a disallowed origin",
+			cfg:    base,
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                        "https://evil.example.org",
+				"Access-Control-Request-Method": http.MethodGet,
+			},
+			wantStatus: http.StatusNoContent,
+			want:       map[string]string{"Access-Control-Allow-Origin": ""},
+			wantVary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:       "options without a preflight",
+			cfg:        base,
+			method:     http.MethodOptions,
+			header:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			want:       map[string]string{"Access-Control-Allow-Origin": "https://app.example.com"},
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name:       "credentials",
+			cfg:        withCredentials,
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+			},
+			wantVary: []string{"Origin"},
+		},
+		{
+			name:       "any origin",
+			cfg:        anyOrigin,
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://anywhere.example.net"},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			want:       map[string]string{"Access-Control-Allow-Origin": "*", "Timing-Allow-Origin": "*"},
+		},
+		{
+			name:   "no max age",
+			cfg:    config.CORS{AllowedOrigins: base.AllowedOrigins, AllowedMethods: base.AllowedMethods},
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": http.MethodGet,
+			},
+			wantStatus: http.StatusNoContent,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Headers": "",
+				"Access-Control-Max-Age":       "",
+			},
+			wantVary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			handler := corsMiddleware(newCORSPolicy(tt.cfg), func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})
+
+			req := httptest.NewRequest(tt.method, "/property", nil)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if called != tt.wantNext {
+				t.Errorf("next called = %v, want %v", called, tt.wantNext)
+			}
+			for name, want := range tt.want {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if got := w.Header().Values("Vary"); !reflect.DeepEqual(got, tt.wantVary) {
+				t.Errorf("Vary = %q, want %q", got, tt.wantVary)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+// Package diskcache provides a small persistent key/value cache backed by a
+// single append-only file
+package diskcache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// minGarbage is how many bytes of stale records may accumulate before a write
+// triggers compaction
+const minGarbage = 1 << 20
+
+// ErrClosed is returned by operations on a closed cache
+var ErrClosed = errors.New("diskcache: cache is closed")
+
+// Options configures a Cache
+type Options struct {
+	// MaxSize bounds the bytes of live records kept on disk. When it is
+	// exceeded the oldest writes are evicted. Zero means unbounded.
+	MaxSize int64
+	// CompactInterval, if set, compacts the file periodically in the
+	// background until Close is called
+	CompactInterval time.Duration
+}
+
+// record is one line of the cache file
+type record struct {
+	Key     string `json:"k"`
+	Value   []byte `json:"v"`
+	Expires int64  `json:"e"`
+}
+
+type entry struct {
+	value   []byte
+	expires time.Time
+	size    int64
+	seq     uint64
+}
+
+// Cache is a persistent key/value cache with per-entry expiry. Every write is
+// appended to the file; superseded and expired records are dropped when the
+// file is compacted. It is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	path    string
+	opts    Options
+	file    *os.File
+	entries map[string]*entry
+	live    int64
+	size    int64
+	seq     uint64
+	nowFunc func() time.Time
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Open loads the cache file at path, creating it if it does not exist
+func Open(path string, opts Options) (*Cache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("diskcache: failed to create directory: %w", err)
+	}
+
+	c := &Cache{
+		path:    path,
+		opts:    opts,
+		entries: make(map[string]*entry),
+		nowFunc: time.Now,
+	}
+
+	dirty, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if dirty || c.size > c.live {
+		// Rewrite the file so a torn or stale tail cannot corrupt later appends
+		if err := c.rewrite(); err != nil {
+			return nil, err
+		}
+	} else if c.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return nil, fmt.Errorf("diskcache: failed to open %s: %w", path, err)
+	}
+
+	if opts.CompactInterval > 0 {
+		c.stop = make(chan struct{})
+		c.done = make(chan struct{})
+		go c.compactLoop(opts.CompactInterval)
+	}
+
+	return c, nil
+}
+
+// load reads every record in the file, reporting whether it found any lines
+// that could not be decoded
+func (c *Cache) load() (dirty bool, err error) {
+	f, err := os.Open(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("diskcache: failed to open %s: %w", c.path, err)
+	}
+	defer f.Close()
+
+	now := c.nowFunc()
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return dirty || len(line) > 0, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("diskcache: failed to read %s: %w", c.path, err)
+		}
+		c.size += int64(len(line))
+
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			dirty = true
+			continue
+		}
+
+		c.remove(rec.Key)
+		expires := time.Unix(0, rec.Expires)
+		if !expires.After(now) {
+			continue
+		}
+		c.add(rec.Key, &entry{value: rec.Value, expires: expires, size: int64(len(line))})
+	}
+}
+
+func (c *Cache) add(key string, e *entry) {
+	c.seq++
+	e.seq = c.seq
+	c.entries[key] = e
+	c.live += e.size
+}
+
+func (c *Cache) remove(key string) {
+	if old, ok := c.entries[key]; ok {
+		c.live -= old.size
+		delete(c.entries, key)
+	}
+}
+
+// Get returns the value stored under key if it exists and has not expired
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !e.expires.After(c.nowFunc()) {
+		c.remove(key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Set stores value under key until ttl has elapsed
+func (c *Cache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return ErrClosed
+	}
+
+	expires := c.nowFunc().Add(ttl)
+	line, err := json.Marshal(record{Key: key, Value: value, Expires: expires.UnixNano()})
+	if err != nil {
+		return fmt.Errorf("diskcache: failed to encode record: %w", err)
+	}
+	line = append(line, '\n')
+
+	if _, err := c.file.Write(line); err != nil {
+		return fmt.Errorf("diskcache: failed to write record: %w", err)
+	}
+	c.size += int64(len(line))
+
+	c.remove(key)
+	c.add(key, &entry{value: value, expires: expires, size: int64(len(line))})
+
+	if c.opts.MaxSize > 0 && c.live > c.opts.MaxSize {
+		c.evict()
+		return c.rewrite()
+	}
+	if garbage := c.size - c.live; garbage > minGarbage && garbage > c.live {
+		return c.rewrite()
+	}
+	return nil
+}
+
+// evict drops the oldest writes until live records use at most 90% of
+// MaxSize, leaving headroom so that eviction is not triggered on every write
+func (c *Cache) evict() {
+	target := c.opts.MaxSize / 10 * 9
+	for _, key := range c.keysByAge() {
+		if c.live <= target {
+			break
+		}
+		c.remove(key)
+	}
+}
+
+// keysByAge lists the keys from oldest to newest write
+func (c *Cache) keysByAge() []string {
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].seq < c.entries[keys[j]].seq
+	})
+	return keys
+}
+
+// Compact rewrites the file with only the live, unexpired records
+func (c *Cache) Compact() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return ErrClosed
+	}
+	return c.rewrite()
+}
+
+// rewrite replaces the file with the current live records, oldest first so
+// that eviction order survives a reload. The caller must hold c.mu.
+func (c *Cache) rewrite() error {
+	now := c.nowFunc()
+	for key, e := range c.entries {
+		if !e.expires.After(now) {
+			c.remove(key)
+		}
+	}
+
+	tmpPath := c.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("diskcache: failed to create %s: %w", tmpPath, err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	var size int64
+	for _, key := range c.keysByAge() {
+		e := c.entries[key]
+		line, err := json.Marshal(record{Key: key, Value: e.value, Expires: e.expires.UnixNano()})
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("diskcache: failed to encode record: %w", err)
+		}
+		line = append(line, '\n')
+		if _, err := writer.Write(line); err != nil {
+			tmp.Close()
+			return fmt.Errorf("diskcache: failed to write %s: %w", tmpPath, err)
+		}
+		e.size = int64(len(line))
+		size += e.size
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("diskcache: failed to write %s: %w", tmpPath, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("diskcache: failed to sync %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("diskcache: failed to close %s: %w", tmpPath, err)
+	}
+
+	if c.file != nil {
+		c.file.Close()
+		c.file = nil
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return fmt.Errorf("diskcache: failed to replace %s: %w", c.path, err)
+	}
+
+	file, err := os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("diskcache: failed to reopen %s: %w", c.path, err)
+	}
+
+	c.file = file
+	c.live = size
+	c.size = size
+	return nil
+}
+
+func (c *Cache) compactLoop(interval time.Duration) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Compact()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Len returns the number of entries currently held, including any that have
+// expired but not yet been dropped
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// Close stops background compaction and syncs and closes the file
+func (c *Cache) Close() error {
+	c.stopOnce.Do(func() {
+		if c.stop != nil {
+			close(c.stop)
+			<-c.done
+		}
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return ErrClosed
+	}
+
+	err := c.file.Sync()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	c.file = nil
+	return err
+}
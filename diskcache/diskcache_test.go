@@ -0,0 +1,175 @@
+package diskcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestCache(t *testing.T, path string, opts Options) *Cache {
+	t.Helper()
+
+	cache, err := Open(path, opts)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	return cache
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	return info.Size()
+}
+
+func TestCachePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "cache.db")
+
+	cache := openTestCache(t, path, Options{})
+	if err := cache.Set("geocode:a", []byte(`{"lat":1}`), time.Hour); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := cache.Set("geocode:a", []byte(`{"lat":2}`), time.Hour); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	cache = openTestCache(t, path, Options{})
+	defer cache.Close()
+
+	value, ok := cache.Get("geocode:a")
+	if !ok || string(value) != `{"lat":2}` {
+		t.Errorf("Get() = %s, %v, want latest value", value, ok)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", cache.Len())
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	cache := openTestCache(t, path, Options{})
+	cache.Set("short", []byte("a"), 10*time.Millisecond)
+	cache.Set("long", []byte("b"), time.Hour)
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.Get("short"); ok {
+		t.Error("Get(short) hit after expiry")
+	}
+	if _, ok := cache.Get("long"); !ok {
+		t.Error("Get(long) missed before expiry")
+	}
+	cache.Close()
+
+	// Expired records are dropped when the file is loaded again
+	cache = openTestCache(t, path, Options{})
+	defer cache.Close()
+	if cache.Len() != 1 {
+		t.Errorf("Len() = %d after reopen, want 1", cache.Len())
+	}
+}
+
+func TestCacheCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache := openTestCache(t, path, Options{})
+	defer cache.Close()
+
+	value := bytes.Repeat([]byte("x"), 100)
+	for i := 0; i < 50; i++ {
+		cache.Set("key", value, time.Hour)
+	}
+	before := fileSize(t, path)
+
+	if err := cache.Compact(); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	after := fileSize(t, path)
+
+	if after*10 > before {
+		t.Errorf("file size after Compact() = %d, want much less than %d", after, before)
+	}
+	if got, ok := cache.Get("key"); !ok || !bytes.Equal(got, value) {
+		t.Error("Get() lost the value during compaction")
+	}
+
+	// Writes after compaction must still land in the file
+	cache.Set("other", []byte("y"), time.Hour)
+	if fileSize(t, path) <= after {
+		t.Error("Set() after Compact() did not append to the file")
+	}
+}
+
+func TestCacheMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache := openTestCache(t, path, Options{MaxSize: 2048})
+	defer cache.Close()
+
+	value := bytes.Repeat([]byte("x"), 100)
+	for i := 0; i < 100; i++ {
+		if err := cache.Set(fmt.Sprintf("key-%03d", i), value, time.Hour); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	if size := fileSize(t, path); size > 2048 {
+		t.Errorf("file size = %d, want at most MaxSize", size)
+	}
+	if _, ok := cache.Get("key-000"); ok {
+		t.Error("Get(key-000) hit, want oldest entry evicted")
+	}
+	if _, ok := cache.Get("key-099"); !ok {
+		t.Error("Get(key-099) missed, want newest entry kept")
+	}
+}
+
+func TestCacheRecoversTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	cache := openTestCache(t, path, Options{})
+	cache.Set("good", []byte("a"), time.Hour)
+	cache.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	f.WriteString(`{"k":"torn","v":"`)
+	f.Close()
+
+	cache = openTestCache(t, path, Options{})
+	cache.Set("after", []byte("b"), time.Hour)
+	cache.Close()
+
+	cache = openTestCache(t, path, Options{})
+	defer cache.Close()
+	for _, key := range []string{"good", "after"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Get(%s) missed after recovering from a torn write", key)
+		}
+	}
+}
+
+func TestCacheClose(t *testing.T) {
+	cache := openTestCache(t, filepath.Join(t.TempDir(), "cache.db"), Options{CompactInterval: time.Millisecond})
+
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := cache.Set("key", []byte("a"), time.Hour); !errors.Is(err, ErrClosed) {
+		t.Errorf("Set() after Close() error = %v, want ErrClosed", err)
+	}
+	if err := cache.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("second Close() error = %v, want ErrClosed", err)
+	}
+}
@@ -3,3 +3,5 @@ module github.com/ssh-keyz/property-details
 go 1.21
 
 require golang.org/x/text v0.21.0
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ssh-keyz/property-details/property"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		level   string
+		wantErr bool
+	}{
+		{name: "defaults", format: "", level: ""},
+		{name: "text at debug", format: "text", level: "debug"},
+		{name: "json at warn", format: "json", level: "WARN"},
+		{name: "unknown format", format: "xml", wantErr: true},
+		{name: "unknown level", level: "loud", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := newLogger(&buf, tt.format, tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newLogger() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			logger.Info("hello")
+			if tt.format != "text" && buf.Len() > 0 && !json.Valid(buf.Bytes()) {
+				t.Errorf("newLogger() wrote %q, want JSON", buf.String())
+			}
+		})
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	server := &Server{
+		service: newTestService(t, property.WithLogger(logger)),
+		logger:  logger,
+	}
+	handler := server.logRequests(http.HandlerFunc(server.handleGetProperty))
+
+	address := "1600 Amphitheatre Parkway, Mountain View, CA 94043"
+	tests := []struct {
+		name     string
+		incoming string
+		wantID   string
+	}{
+		{name: "generated", incoming: ""},
+		{name: "reused", incoming: "client-abc.123", wantID: "client-abc.123"},
+		{name: "unsafe replaced", incoming: "bad id\nforged=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/property?address="+url.QueryEscape(address), nil)
+			if tt.incoming != "" {
+				req.Header.Set(requestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			id := w.Header().Get(requestIDHeader)
+			if !validRequestID(id) {
+				t.Fatalf("%s = %q, want a valid ID", requestIDHeader, id)
+			}
+			if tt.wantID != "" && id != tt.wantID {
+				t.Fatalf("%s = %q, want %q", requestIDHeader, id, tt.wantID)
+			}
+			if tt.wantID == "" && id == tt.incoming {
+				t.Fatalf("%s = %q, want a generated ID", requestIDHeader, id)
+			}
+
+			var sawStage, sawAccess bool
+			decoder := json.NewDecoder(&logs)
+			for decoder.More() {
+				var record map[string]any
+				if err := decoder.Decode(&record); err != nil {
+					t.Fatalf("Failed to decode log record: %v", err)
+				}
+				if record["request_id"] != id {
+					t.Errorf("log record %v does not carry request ID %s", record, id)
+				}
+				switch record["msg"] {
+				case "Lookup stage finished":
+					sawStage = true
+				case "Request handled":
+					sawAccess = true
+					if record["status"] != float64(http.StatusOK) || record["path"] != "/property" {
+						t.Errorf("access record = %v, want status 200 for /property", record)
+					}
+				}
+			}
+			if !sawStage || !sawAccess {
+				t.Errorf("logs = %s, want stage and access records", logs.String())
+			}
+		})
+	}
+}
@@ -2,88 +2,289 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/ssh-keyz/property-details/config"
+	"github.com/ssh-keyz/property-details/diskcache"
+	"github.com/ssh-keyz/property-details/opencage"
 	"github.com/ssh-keyz/property-details/property"
+	"github.com/ssh-keyz/property-details/tracing"
 )
 
 type Server struct {
-	service *property.Service
-}
-
-// CORS middleware to handle cross-origin requests
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Get the origin from the request header
-		origin := r.Header.Get("Origin")
-
-		// Allow requests from these origins
-		allowedOrigins := map[string]bool{
-			"https://property-details-client.vercel.app": true,
-			"http://localhost:4321":                      true,
-		}
-
-		// If the origin is allowed, set it in the response header
-		if allowedOrigins[origin] {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		}
-
-		// Handle preflight requests
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next(w, r)
-	}
+	service   *property.Service
+	logger    *slog.Logger
+	metrics   *serverMetrics
+	tracer    *tracing.Tracer
+	readiness *readiness
+	config    *config.Config
 }
 
 func (s *Server) handleGetProperty(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeProblem(w, newProblem(http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed"))
 		return
 	}
 
 	address := r.URL.Query().Get("address")
 	if address == "" {
-		http.Error(w, "Address parameter is required", http.StatusBadRequest)
+		writeProblem(w, newProblem(http.StatusBadRequest, codeMissingAddress, "Address parameter is required"))
 		return
 	}
 
 	// URL decode the address
 	decodedAddress, err := url.QueryUnescape(address)
 	if err != nil {
-		http.Error(w, "Invalid address format", http.StatusBadRequest)
+		writeProblem(w, newProblem(http.StatusBadRequest, codeMalformedAddress, "Invalid address encoding"))
 		return
 	}
 
-	info, err := s.service.GetInfo(decodedAddress)
+	start := time.Now()
+	info, err := s.service.GetInfoContext(r.Context(), decodedAddress)
+	total := time.Since(start)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting property info: %v", err), http.StatusInternalServerError)
+		// Nobody is left to read the response
+		if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+			return
+		}
+		writeProblem(w, problemFor(err))
 		return
 	}
 
+	// Report partial results so clients can tell a missing section from an empty one
+	status := http.StatusOK
+	if !info.Complete() {
+		status = http.StatusPartialContent
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Server-Timing", serverTiming(info, total))
+	w.WriteHeader(status)
+
+	if debugRequested(r) {
+		json.NewEncoder(w).Encode(struct {
+			*property.Info
+			Debug *debugInfo `json:"debug"`
+		}{info, newDebugInfo(info, total)})
+		return
+	}
 	json.NewEncoder(w).Encode(info)
 }
 
+// healthResponse reports the circuit breaker state of each upstream provider,
+// and the remaining OpenCage quota once known
+type healthResponse struct {
+	Status        string                            `json:"status"`
+	Upstreams     map[string]property.BreakerStatus `json:"upstreams"`
+	OpenCageQuota *opencage.Quota                   `json:"opencage_quota,omitempty"`
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeProblem(w, newProblem(http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	// An open breaker degrades results but the service still answers
+	response := healthResponse{Status: "ok", Upstreams: s.service.Breakers()}
+	for _, status := range response.Upstreams {
+		if status.State != property.BreakerClosed {
+			response.Status = "degraded"
+		}
+	}
+	if quota, ok := s.service.OpenCageQuota(); ok {
+		response.OpenCageQuota = &quota
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// newGeocoder selects the geocoding provider by name, pointing Nominatim at
+// nominatimURL
+func newGeocoder(name, nominatimURL string) (property.Geocoder, error) {
+	switch name {
+	case "", property.ProviderNominatim:
+		geocoder := property.NewNominatimGeocoder(nil)
+		if nominatimURL != "" {
+			geocoder.BaseURL = nominatimURL
+		}
+		return geocoder, nil
+	case property.ProviderOpenCage:
+		return property.NewOpenCageGeocoder(nil), nil
+	default:
+		return nil, fmt.Errorf("unknown geocoder %q", name)
+	}
+}
+
 func main() {
-	server := &Server{
-		service: property.NewService(),
+	load := func() (*config.Config, error) {
+		return config.Load(os.Args[1:], os.Getenv)
+	}
+	cfg, err := load()
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	logger, err := newLogger(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg, load, logger); err != nil {
+		logger.Error("Server failed", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Server stopped")
+}
+
+// serviceOptions translates the configuration into property service options
+func serviceOptions(cfg *config.Config, geocoder property.Geocoder) []property.Option {
+	opts := []property.Option{
+		property.WithGeocoder(geocoder),
+		property.WithOpenCageURL(cfg.Upstreams.OpenCageURL),
+		property.WithOpenCageAPIKey(cfg.Upstreams.OpenCageAPIKey.Value()),
+		property.WithOverpassURL(cfg.Upstreams.OverpassURL),
+		property.WithUpstreamTimeout(time.Duration(cfg.Upstreams.Timeout)),
+		property.WithSchoolRadius(cfg.Schools.RadiusMetres),
+	}
+
+	// Limits follow each provider to whichever host it is configured at
+	for _, provider := range []struct {
+		endpoint string
+		limit    config.RateLimit
+	}{
+		{cfg.Upstreams.NominatimURL, cfg.RateLimits.Nominatim},
+		{cfg.Upstreams.OpenCageURL, cfg.RateLimits.OpenCage},
+		{cfg.Upstreams.OverpassURL, cfg.RateLimits.Overpass},
+	} {
+		// Validated as absolute URLs when the configuration was loaded
+		if u, err := url.Parse(provider.endpoint); err == nil {
+			opts = append(opts, property.WithRateLimit(u.Host, property.RateLimit(provider.limit)))
+		}
+	}
+	return opts
+}
+
+// routes builds the handler serving every endpoint with this server's
+// configuration
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	// Apply CORS middleware to the property endpoints
+	cors := newCORSPolicy(s.config.CORS)
+	mux.HandleFunc("/property", corsMiddleware(cors, s.metrics.instrument("/property", s.traceRoute("/property", s.handleGetProperty))))
+	mux.HandleFunc("/properties", corsMiddleware(cors, s.metrics.instrument("/properties", s.traceRoute("/properties", s.handleBatch))))
+	mux.HandleFunc("/health", s.metrics.instrument("/health", s.handleHealth))
+	mux.HandleFunc("/healthz", s.metrics.instrument("/healthz", s.handleLiveness))
+	mux.HandleFunc("/readyz", s.metrics.instrument("/readyz", s.handleReadiness))
+	mux.Handle("/metrics", s.metrics.registry)
+	if token := s.config.Admin.Token.Value(); token != "" {
+		mux.HandleFunc("/admin/config", requireAdmin(token, s.handleConfig))
+	}
+	return s.logRequests(mux)
+}
+
+// run serves until ctx is done, then drains in-flight requests and stops
+// background work before the cache store and trace file are closed. The
+// configuration is reloaded with load on SIGHUP or when its file changes.
+func run(ctx context.Context, cfg *config.Config, load func() (*config.Config, error), logger *slog.Logger) error {
+	tracer, traceFile, err := newTracer(cfg.Tracing.Exporter, cfg.Tracing.File)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	defer traceFile.Close()
+
+	opts := []property.Option{
+		property.WithLogger(logger),
+		property.WithTracer(tracer),
+	}
+
+	// Persist geocodes and school lookups so restarts do not start cold
+	if path := cfg.Cache.Path; path != "" {
+		store, err := diskcache.Open(path, diskcache.Options{
+			MaxSize:         64 << 20,
+			CompactInterval: time.Hour,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to open cache %s: %w", path, err)
+		}
+		defer func() {
+			if err := store.Close(); err != nil {
+				logger.Error("Failed to close cache", "path", path, "error", err)
+			}
+		}()
+		opts = append(opts, property.WithStore(store))
 	}
 
-	// Apply CORS middleware to the property endpoint
-	http.HandleFunc("/property", corsMiddleware(server.handleGetProperty))
+	live, err := newLiveServer(cfg, load, logger, tracer, opts)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
 
-	port := ":8080"
-	log.Printf("Starting server on port %s", port)
-	if err := http.ListenAndServe(port, nil); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	ln, err := net.Listen("tcp", cfg.Server.Addr)
+	if err != nil {
+		return err
 	}
+	logger.Info("Starting server", "addr", ln.Addr().String())
+
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	var wg sync.WaitGroup
+
+	// Upstream reachability only gates readiness when probing is enabled
+	if interval := time.Duration(cfg.Readiness.ProbeInterval); interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			live.readiness.run(background, interval)
+		}()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		live.watch(background, cfg.Path, configPollInterval, hup)
+	}()
+
+	shutdownTimeout := time.Duration(cfg.Server.ShutdownTimeout)
+	httpServer := newHTTPServer(cfg.Server, live, logger)
+	serveErr := serve(ctx, httpServer, ln, shutdownTimeout, logger)
+
+	stopBackground()
+	wg.Wait()
+
+	// Lookups abandoned by their clients may still be writing to the cache
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := live.shutdown(shutdownCtx); err != nil {
+		logger.Warn("Background lookups did not finish before shutdown", "error", err)
+	}
+
+	return serveErr
 }
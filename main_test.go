@@ -1,19 +1,56 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ssh-keyz/property-details/config"
 	"github.com/ssh-keyz/property-details/property"
 )
 
+// newTestService returns a property service whose upstreams are served by a
+// local stand-in for Nominatim, OpenCage and Overpass. Extra options are
+// applied last, so they can point individual upstreams elsewhere.
+func newTestService(t *testing.T, opts ...property.Option) *property.Service {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/search":
+			w.Write([]byte(`[{"lat": "37.42248575", "lon": "-122.08558456613565"}]`))
+		case "/geocode/v1/json":
+			w.Write([]byte(`{"results": [{"components": {"type": "residential", "building": "house"}}], "status": {"code": 200}}`))
+		case "/api/interpreter":
+			w.Write([]byte(`{"elements": [{"type": "node", "lat": 37.4236, "lon": -122.0942, "tags": {"name": "Example School", "amenity": "school"}}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	geocoder := property.NewNominatimGeocoder(nil)
+	geocoder.BaseURL = upstream.URL + "/search"
+
+	return property.NewService(append([]property.Option{
+		property.WithGeocoder(geocoder),
+		property.WithOpenCageURL(upstream.URL + "/geocode/v1/json"),
+		property.WithOpenCageAPIKey("test-key"),
+		property.WithOverpassURL(upstream.URL + "/api/interpreter"),
+	}, opts...)...)
+}
+
 func TestHandleGetProperty(t *testing.T) {
 	// Create a new server instance
 	server := &Server{
-		service: property.NewService(),
+		service: newTestService(t),
 	}
 
 	tests := []struct {
@@ -37,7 +74,7 @@ func TestHandleGetProperty(t *testing.T) {
 		{
 			name:           "invalid address format",
 			address:        "invalid!!!address",
-			expectedStatus: http.StatusInternalServerError,
+			expectedStatus: http.StatusUnprocessableEntity,
 			wantErr:        true,
 		},
 	}
@@ -91,9 +128,144 @@ func TestHandleGetProperty(t *testing.T) {
 	}
 }
 
+func TestHandleGetPropertyPartial(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+	}))
+	defer broken.Close()
+
+	server := &Server{
+		service: newTestService(t,
+			property.WithOverpassURL(broken.URL),
+			property.WithRetryPolicy(property.RetryPolicy{}),
+		),
+	}
+
+	address := "1600 Amphitheatre Parkway, Mountain View, CA 94043"
+	req := httptest.NewRequest(http.MethodGet, "/property?address="+url.QueryEscape(address), nil)
+	w := httptest.NewRecorder()
+
+	server.handleGetProperty(w, req)
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("handleGetProperty() status = %v, want %v", w.Code, http.StatusPartialContent)
+	}
+
+	var response property.Info
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Coordinates == nil || response.Details == nil {
+		t.Error("Response is missing the sections that succeeded")
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Section != property.SectionSchools {
+		t.Errorf("Response errors = %+v, want schools only", response.Errors)
+	}
+}
+
+func TestHandleHealth(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	server := &Server{
+		service: newTestService(t,
+			property.WithOverpassURL(broken.URL),
+			property.WithRetryPolicy(property.RetryPolicy{}),
+			property.WithBreaker(property.BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}),
+		),
+	}
+
+	health := func() healthResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.handleHealth(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("handleHealth() status = %v, want %v", w.Code, http.StatusOK)
+		}
+		var response healthResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	if response := health(); response.Status != "ok" || len(response.Upstreams) != 3 {
+		t.Fatalf("handleHealth() = %+v, want ok with 3 upstreams", response)
+	}
+
+	server.service.GetInfo("1600 Amphitheatre Parkway, Mountain View, CA 94043")
+
+	response := health()
+	if response.Status != "degraded" {
+		t.Errorf("handleHealth() status = %q, want degraded", response.Status)
+	}
+	if state := response.Upstreams[property.ProviderOverpass].State; state != property.BreakerOpen {
+		t.Errorf("overpass breaker = %q, want open", state)
+	}
+	if state := response.Upstreams[property.ProviderNominatim].State; state != property.BreakerClosed {
+		t.Errorf("nominatim breaker = %q, want closed", state)
+	}
+}
+
+func TestAPIKeyNotLeaked(t *testing.T) {
+	const key = "top-secret-opencage-key"
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	geocoder := property.NewOpenCageGeocoder(nil)
+	tests := []struct {
+		name string
+		opts []property.Option
+	}{
+		{
+			name: "details unreachable",
+			opts: []property.Option{property.WithOpenCageURL(down.URL)},
+		},
+		{
+			name: "every upstream unreachable",
+			opts: []property.Option{
+				property.WithGeocoder(geocoder),
+				property.WithOpenCageURL(down.URL),
+				property.WithOverpassURL(down.URL),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append(tt.opts,
+				property.WithOpenCageAPIKey(key),
+				property.WithLogger(logger),
+				property.WithRetryPolicy(property.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+			)
+			server := &Server{service: newTestService(t, opts...), logger: logger}
+
+			address := "1600 Amphitheatre Parkway, Mountain View, CA 94043"
+			w := httptest.NewRecorder()
+			server.logRequests(http.HandlerFunc(server.handleGetProperty)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/property?address="+url.QueryEscape(address), nil))
+
+			if w.Code == http.StatusOK {
+				t.Fatalf("handleGetProperty() status = %v, want a failure", w.Code)
+			}
+			if body := w.Body.String(); strings.Contains(body, key) {
+				t.Errorf("response body leaks the API key: %s", body)
+			}
+			if strings.Contains(logs.String(), key) {
+				t.Errorf("logs leak the API key: %s", logs.String())
+			}
+		})
+	}
+}
+
 func TestMethodNotAllowed(t *testing.T) {
 	server := &Server{
-		service: property.NewService(),
+		service: newTestService(t),
 	}
 
 	methods := []string{http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch}
@@ -111,3 +283,48 @@ func TestMethodNotAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestNewGeocoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default", provider: "", want: "nominatim"},
+		{name: "nominatim", provider: "nominatim", want: "nominatim"},
+		{name: "opencage", provider: "opencage", want: "opencage"},
+		{name: "unknown", provider: "google", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			geocoder, err := newGeocoder(tt.provider, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newGeocoder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && geocoder.Name() != tt.want {
+				t.Errorf("newGeocoder() = %v, want %v", geocoder.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceOptionsRateLimits(t *testing.T) {
+	cfg := config.Default()
+	cfg.Upstreams.OverpassURL = "http://overpass.internal/api/interpreter"
+	cfg.RateLimits.Overpass = config.RateLimit{Rate: 5, Burst: 10}
+	cfg.RateLimits.Nominatim.Rate = 0
+
+	service := property.NewService(serviceOptions(cfg, property.NewNominatimGeocoder(nil))...)
+	limits := service.Stats().RateLimits
+	if _, ok := limits["overpass.internal"]; !ok {
+		t.Errorf("rate limited hosts = %v, want the configured Overpass host", limits)
+	}
+	if _, ok := limits["nominatim.openstreetmap.org"]; ok {
+		t.Errorf("rate limited hosts = %v, want Nominatim's limit lifted", limits)
+	}
+	if _, ok := limits["api.opencagedata.com"]; !ok {
+		t.Errorf("rate limited hosts = %v, want OpenCage's default kept", limits)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ssh-keyz/property-details/metrics"
+	"github.com/ssh-keyz/property-details/property"
+)
+
+// serverMetrics records HTTP request metrics and exposes the property
+// service's own counters, which are read on every scrape. The service's
+// counters start from zero again when a reload replaces it.
+type serverMetrics struct {
+	registry *metrics.Registry
+	requests *metrics.Counter
+	duration *metrics.Histogram
+	service  atomic.Pointer[property.Service]
+}
+
+func newServerMetrics(service *property.Service) *serverMetrics {
+	r := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: r,
+		requests: r.NewCounter("property_http_requests_total",
+			"HTTP requests handled, by path, method and status code.", "path", "method", "code"),
+		duration: r.NewHistogram("property_http_request_duration_seconds",
+			"HTTP request latency in seconds, by path.", nil, "path"),
+	}
+	m.service.Store(service)
+
+	upstreams := func(emit func(e metrics.Emitter, provider string, stats property.UpstreamStats)) func(metrics.Emitter) {
+		return func(e metrics.Emitter) {
+			stats := m.service.Load().Stats().Upstreams
+			for _, provider := range sortedKeys(stats) {
+				emit(e, provider, stats[provider])
+			}
+		}
+	}
+	r.NewCollector("property_upstream_requests_total", "Lookups sent to each upstream provider.", metrics.KindCounter,
+		upstreams(func(e metrics.Emitter, provider string, stats property.UpstreamStats) {
+			e.Value(float64(stats.Calls), metrics.Labels{"provider": provider})
+		}))
+	r.NewCollector("property_upstream_errors_total", "Lookups to each upstream provider that failed.", metrics.KindCounter,
+		upstreams(func(e metrics.Emitter, provider string, stats property.UpstreamStats) {
+			e.Value(float64(stats.Errors), metrics.Labels{"provider": provider})
+		}))
+	r.NewCollector("property_upstream_request_duration_seconds", "Upstream lookup latency in seconds, including retries.", metrics.KindHistogram,
+		upstreams(func(e metrics.Emitter, provider string, stats property.UpstreamStats) {
+			e.Histogram(latencySnapshot(stats.Latency), metrics.Labels{"provider": provider})
+		}))
+
+	caches := func(value func(property.CacheStats) float64) func(metrics.Emitter) {
+		return func(e metrics.Emitter) {
+			stats := m.service.Load().Stats().Cache
+			for _, section := range sortedKeys(stats) {
+				e.Value(value(stats[section]), metrics.Labels{"section": string(section)})
+			}
+		}
+	}
+	r.NewCollector("property_cache_hits_total", "In-memory cache hits, by section.", metrics.KindCounter,
+		caches(func(s property.CacheStats) float64 { return float64(s.Hits) }))
+	r.NewCollector("property_cache_misses_total", "In-memory cache misses, by section.", metrics.KindCounter,
+		caches(func(s property.CacheStats) float64 { return float64(s.Misses) }))
+	r.NewCollector("property_cache_hit_ratio", "Share of in-memory cache lookups that hit since startup, by section.", metrics.KindGauge,
+		caches(func(s property.CacheStats) float64 {
+			if s.Hits+s.Misses == 0 {
+				return 0
+			}
+			return float64(s.Hits) / float64(s.Hits+s.Misses)
+		}))
+	r.NewCollector("property_cache_entries", "Entries held in the in-memory cache, by section.", metrics.KindGauge,
+		caches(func(s property.CacheStats) float64 { return float64(s.Entries) }))
+	r.NewCollector("property_cache_store_hits_total", "Persistent cache hits after an in-memory miss, by section.", metrics.KindCounter,
+		caches(func(s property.CacheStats) float64 { return float64(s.StoreHits) }))
+	r.NewCollector("property_cache_store_misses_total", "Persistent cache misses, by section.", metrics.KindCounter,
+		caches(func(s property.CacheStats) float64 { return float64(s.StoreMisses) }))
+
+	r.NewCollector("property_coalesced_lookups_total", "Lookups that joined an identical lookup already in flight, by section.", metrics.KindCounter,
+		func(e metrics.Emitter) {
+			coalesced := m.service.Load().Stats().Coalesced
+			for _, section := range sortedKeys(coalesced) {
+				e.Value(float64(coalesced[section]), metrics.Labels{"section": string(section)})
+			}
+		})
+
+	limits := func(value func(property.RateLimitStats) float64) func(metrics.Emitter) {
+		return func(e metrics.Emitter) {
+			stats := m.service.Load().Stats().RateLimits
+			for _, host := range sortedKeys(stats) {
+				e.Value(value(stats[host]), metrics.Labels{"host": host})
+			}
+		}
+	}
+	r.NewCollector("property_ratelimit_waits_total", "Upstream requests held back by the client-side rate limiter, by host.", metrics.KindCounter,
+		limits(func(s property.RateLimitStats) float64 { return float64(s.Waits) }))
+	r.NewCollector("property_ratelimit_wait_seconds_total", "Time upstream requests spent waiting for the rate limiter, by host.", metrics.KindCounter,
+		limits(func(s property.RateLimitStats) float64 { return s.WaitTime.Seconds() }))
+	r.NewCollector("property_ratelimit_rejections_total", "Upstream requests rejected by the rate limiter, by host.", metrics.KindCounter,
+		limits(func(s property.RateLimitStats) float64 { return float64(s.Rejected) }))
+
+	r.NewCollector("property_circuit_breaker_state", "Circuit breaker state of each upstream provider; 1 for the current state.", metrics.KindGauge,
+		func(e metrics.Emitter) {
+			breakers := m.service.Load().Breakers()
+			for _, provider := range sortedKeys(breakers) {
+				for _, state := range []property.BreakerState{property.BreakerClosed, property.BreakerOpen, property.BreakerHalfOpen} {
+					value := 0.0
+					if breakers[provider].State == state {
+						value = 1
+					}
+					e.Value(value, metrics.Labels{"provider": provider, "state": string(state)})
+				}
+			}
+		})
+
+	r.NewCollector("property_opencage_quota_remaining", "OpenCage requests left in the daily quota, once reported.", metrics.KindGauge,
+		func(e metrics.Emitter) {
+			if quota, ok := m.service.Load().OpenCageQuota(); ok {
+				e.Value(float64(quota.Remaining), nil)
+			}
+		})
+
+	return m
+}
+
+// setService reports the counters of service from now on
+func (m *serverMetrics) setService(service *property.Service) {
+	m.service.Store(service)
+}
+
+// instrument records the count and latency of requests to path
+func (m *serverMetrics) instrument(path string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.requests.Inc(path, methodLabel(r.Method), strconv.Itoa(status))
+		m.duration.Observe(time.Since(start).Seconds(), path)
+	}
+}
+
+// methodLabel returns method if it is a standard HTTP method, and "other"
+// otherwise, so that clients cannot create a series per made-up method
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// latencySnapshot converts the service's latency histogram to seconds
+func latencySnapshot(stats property.LatencyStats) metrics.HistogramSnapshot {
+	buckets := make([]float64, len(stats.Buckets))
+	for i, bound := range stats.Buckets {
+		buckets[i] = bound.Seconds()
+	}
+	return metrics.HistogramSnapshot{
+		Buckets: buckets,
+		Counts:  stats.Counts,
+		Count:   stats.Count,
+		Sum:     stats.Sum.Seconds(),
+	}
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,361 @@
+// Package metrics implements a minimal metrics registry rendered in the
+// Prometheus text exposition format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Kind is the type of a metric family
+type Kind string
+
+// Metric kinds
+const (
+	KindCounter   Kind = "counter"
+	KindGauge     Kind = "gauge"
+	KindHistogram Kind = "histogram"
+)
+
+// DefaultBuckets are latency histogram bounds in seconds, suited to calls to
+// remote APIs
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Labels maps label names to values
+type Labels map[string]string
+
+// HistogramSnapshot is the state of one histogram series. Counts holds the
+// number of observations at or below each bound in Buckets, not cumulative.
+type HistogramSnapshot struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+// Emitter receives the samples of a collected family
+type Emitter interface {
+	Value(v float64, labels Labels)
+	Histogram(h HistogramSnapshot, labels Labels)
+}
+
+// family is one named metric with its help text and samples
+type family interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families and renders them for scraping
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.families {
+		if existing.name() == f.name() {
+			panic("metrics: duplicate metric " + f.name())
+		}
+	}
+	r.families = append(r.families, f)
+}
+
+// WriteTo renders every family in registration order
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the registry in the text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+// vec tracks series keyed by their label values
+type vec struct {
+	fullName   string
+	help       string
+	kind       Kind
+	labelNames []string
+}
+
+func (v *vec) name() string {
+	return v.fullName
+}
+
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.fullName, len(v.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (v *vec) labels(key string) Labels {
+	labels := make(Labels, len(v.labelNames))
+	if len(v.labelNames) == 0 {
+		return labels
+	}
+	for i, value := range strings.Split(key, "\xff") {
+		labels[v.labelNames[i]] = value
+	}
+	return labels
+}
+
+// Counter is a monotonically increasing value per label combination
+type Counter struct {
+	vec
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter registers a counter with the given label names
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{
+		vec:    vec{fullName: name, help: help, kind: KindCounter, labelNames: labelNames},
+		values: make(map[string]float64),
+	}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	samples := make(map[string]float64, len(c.values))
+	for k, v := range c.values {
+		samples[k] = v
+	}
+	c.mu.Unlock()
+
+	writeHeader(w, c.fullName, c.help, c.kind)
+	for _, key := range sortedKeys(samples) {
+		writeSample(w, c.fullName, c.labels(key), samples[key])
+	}
+}
+
+// Histogram counts observations into buckets per label combination
+type Histogram struct {
+	vec
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*HistogramSnapshot
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds,
+// which must be sorted. DefaultBuckets is used if buckets is nil.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{
+		vec:     vec{fullName: name, help: help, kind: KindHistogram, labelNames: labelNames},
+		buckets: buckets,
+		series:  make(map[string]*HistogramSnapshot),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records v in the series with the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &HistogramSnapshot{Buckets: h.buckets, Counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.Counts[i]++
+	}
+	s.Count++
+	s.Sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	samples := make(map[string]HistogramSnapshot, len(h.series))
+	for k, s := range h.series {
+		snapshot := *s
+		snapshot.Counts = slices.Clone(s.Counts)
+		samples[k] = snapshot
+	}
+	h.mu.Unlock()
+
+	writeHeader(w, h.fullName, h.help, h.kind)
+	for _, key := range sortedKeys(samples) {
+		writeHistogram(w, h.fullName, h.labels(key), samples[key])
+	}
+}
+
+// collector renders samples gathered by a callback at scrape time
+type collector struct {
+	fullName string
+	help     string
+	kind     Kind
+	collect  func(Emitter)
+}
+
+// NewCollector registers a family whose samples are produced by collect on
+// every scrape, for values already tracked elsewhere
+func (r *Registry) NewCollector(name, help string, kind Kind, collect func(Emitter)) {
+	r.register(&collector{fullName: name, help: help, kind: kind, collect: collect})
+}
+
+func (c *collector) name() string {
+	return c.fullName
+}
+
+func (c *collector) write(w *bufio.Writer) {
+	writeHeader(w, c.fullName, c.help, c.kind)
+	c.collect(&emitter{w: w, name: c.fullName})
+}
+
+type emitter struct {
+	w    *bufio.Writer
+	name string
+}
+
+func (e *emitter) Value(v float64, labels Labels) {
+	writeSample(e.w, e.name, labels, v)
+}
+
+func (e *emitter) Histogram(h HistogramSnapshot, labels Labels) {
+	writeHistogram(e.w, e.name, labels, h)
+}
+
+func writeHeader(w *bufio.Writer, name, help string, kind Kind) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func writeHistogram(w *bufio.Writer, name string, labels Labels, h HistogramSnapshot) {
+	var cumulative uint64
+	for i, bound := range h.Buckets {
+		cumulative += h.Counts[i]
+		writeSample(w, name+"_bucket", withLabel(labels, "le", formatFloat(bound)), float64(cumulative))
+	}
+	writeSample(w, name+"_bucket", withLabel(labels, "le", "+Inf"), float64(h.Count))
+	writeSample(w, name+"_sum", labels, h.Sum)
+	writeSample(w, name+"_count", labels, float64(h.Count))
+}
+
+func writeSample(w *bufio.Writer, name string, labels Labels, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		names := make([]string, 0, len(labels))
+		for k := range labels {
+			names = append(names, k)
+		}
+		// le always comes last, as in the reference client
+		sort.Slice(names, func(i, j int) bool {
+			if (names[i] == "le") != (names[j] == "le") {
+				return names[j] == "le"
+			}
+			return names[i] < names[j]
+		})
+
+		w.WriteByte('{')
+		for i, k := range names {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, k, labelEscaper.Replace(labels[k]))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func withLabel(labels Labels, name, value string) Labels {
+	out := make(Labels, len(labels)+1)
+	for k, v := range labels {
+		out[k] = v
+	}
+	out[name] = value
+	return out
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounter("requests_total", "Requests handled.", "path", "code")
+	requests.Inc("/property", "200")
+	requests.Inc("/property", "200")
+	requests.Add(3, "/property", "404")
+
+	latency := r.NewHistogram("request_duration_seconds", "Request latency.", []float64{0.1, 1}, "path")
+	latency.Observe(0.05, "/property")
+	latency.Observe(0.1, "/property")
+	latency.Observe(0.5, "/property")
+	latency.Observe(7, "/property")
+
+	r.NewCollector("cache_entries", "Cached entries.", KindGauge, func(e Emitter) {
+		e.Value(12, Labels{"section": `geo"code`})
+	})
+	r.NewCollector("upstream_duration_seconds", "Upstream latency.", KindHistogram, func(e Emitter) {
+		e.Histogram(HistogramSnapshot{Buckets: []float64{1}, Counts: []uint64{2}, Count: 3, Sum: 4.5}, Labels{"provider": "overpass"})
+	})
+
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	want := `# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{code="200",path="/property"} 2
+requests_total{code="404",path="/property"} 3
+# HELP request_duration_seconds Request latency.
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{path="/property",le="0.1"} 2
+request_duration_seconds_bucket{path="/property",le="1"} 3
+request_duration_seconds_bucket{path="/property",le="+Inf"} 4
+request_duration_seconds_sum{path="/property"} 7.65
+request_duration_seconds_count{path="/property"} 4
+# HELP cache_entries Cached entries.
+# TYPE cache_entries gauge
+cache_entries{section="geo\"code"} 12
+# HELP upstream_duration_seconds Upstream latency.
+# TYPE upstream_duration_seconds histogram
+upstream_duration_seconds_bucket{provider="overpass",le="1"} 2
+upstream_duration_seconds_bucket{provider="overpass",le="+Inf"} 3
+upstream_duration_seconds_sum{provider="overpass"} 4.5
+upstream_duration_seconds_count{provider="overpass"} 3
+`
+	if got := out.String(); got != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("up_total", "Scrapes.").Inc()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got := w.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	if !strings.Contains(w.Body.String(), "up_total 1\n") {
+		t.Errorf("body = %q, want up_total 1", w.Body.String())
+	}
+}
+
+func TestRegistryRejectsDuplicates(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate metric did not panic")
+		}
+	}()
+
+	r := NewRegistry()
+	r.NewCounter("dup_total", "First.")
+	r.NewCounter("dup_total", "Second.")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ssh-keyz/property-details/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	service := newTestService(t)
+	server := &Server{
+		service: service,
+		metrics: newServerMetrics(service),
+	}
+	handler := server.metrics.instrument("/property", server.handleGetProperty)
+
+	address := url.QueryEscape("1600 Amphitheatre Parkway, Mountain View, CA 94043")
+	for _, target := range []string{
+		"/property?address=" + address,
+		"/property?address=" + address,
+		"/property",
+	} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	for _, method := range []string{"FOO1", "FOO2"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(method, "/property", nil))
+	}
+
+	w := httptest.NewRecorder()
+	server.metrics.registry.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got := w.Header().Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, metrics.ContentType)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`property_http_requests_total{code="200",method="GET",path="/property"} 2`,
+		`property_http_requests_total{code="400",method="GET",path="/property"} 1`,
+		`property_http_requests_total{code="405",method="other",path="/property"} 2`,
+		`property_http_request_duration_seconds_count{path="/property"} 5`,
+		`property_upstream_requests_total{provider="nominatim"} 1`,
+		`property_upstream_requests_total{provider="opencage"} 1`,
+		`property_upstream_errors_total{provider="overpass"} 0`,
+		`property_upstream_request_duration_seconds_count{provider="overpass"} 1`,
+		`property_cache_hits_total{section="geocode"} 1`,
+		`property_cache_hit_ratio{section="details"} 0.5`,
+		`property_cache_entries{section="schools"} 1`,
+		`property_ratelimit_waits_total{host="nominatim.openstreetmap.org"} 0`,
+		`property_circuit_breaker_state{provider="overpass",state="closed"} 1`,
+		`# TYPE property_opencage_quota_remaining gauge`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics are missing %q", want)
+		}
+	}
+}
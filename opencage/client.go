@@ -0,0 +1,164 @@
+package opencage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the OpenCage forward geocoding endpoint
+const DefaultBaseURL = "https://api.opencagedata.com/geocode/v1/json"
+
+// Quota is the account's daily request quota as last reported by the API
+type Quota struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// StatusError is returned when the API reports a failure, either through the
+// HTTP status or the status block of the response. Message is taken from the
+// status block when present, and Quota is set if the response reported one.
+type StatusError struct {
+	StatusCode int
+	Message    string
+	Header     http.Header
+	Quota      *Quota
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("opencage returned %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("opencage returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Client issues forward geocoding requests against the OpenCage API
+type Client struct {
+	HTTPClient *http.Client
+	BaseURL    string
+	APIKey     string
+
+	mu    sync.Mutex
+	quota *Quota
+}
+
+// NewClient creates a client for the public OpenCage endpoint
+func NewClient(httpClient *http.Client, apiKey string) *Client {
+	return &Client{
+		HTTPClient: httpClient,
+		BaseURL:    DefaultBaseURL,
+		APIKey:     apiKey,
+	}
+}
+
+// Quota returns the quota reported by the most recent response that carried
+// one. It reports false until then, or if the account has no limit.
+func (c *Client) Quota() (Quota, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.quota == nil {
+		return Quota{}, false
+	}
+	return *c.quota, true
+}
+
+// Geocode looks up the given free-form query and returns the decoded response
+func (c *Client) Geocode(ctx context.Context, query string) (*Response, error) {
+	endpoint := fmt.Sprintf("%s?q=%s&key=%s", c.BaseURL, url.QueryEscape(query), url.QueryEscape(c.APIKey))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", c.redact(err))
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch response: %w", c.redact(err))
+	}
+	defer resp.Body.Close()
+
+	// Error bodies are usually JSON too, but gateways may send HTML, so the
+	// decode error only matters for successful responses
+	var result Response
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
+
+	quota := parseQuota(resp.Header, result.Rate)
+	if quota != nil {
+		c.mu.Lock()
+		c.quota = quota
+		c.mu.Unlock()
+	}
+
+	code := resp.StatusCode
+	if code >= 200 && code < 300 && decodeErr == nil && result.Status.Code != 0 {
+		code = result.Status.Code
+	}
+	if code < 200 || code >= 300 {
+		return nil, &StatusError{
+			StatusCode: code,
+			Message:    result.Status.Message,
+			Header:     resp.Header,
+			Quota:      quota,
+		}
+	}
+
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", decodeErr)
+	}
+
+	return &result, nil
+}
+
+// redactedKey replaces the API key in URLs that end up in errors
+const redactedKey = "REDACTED"
+
+// redact removes the API key from the URL carried by a *url.Error, which
+// would otherwise leak it into every message that includes err
+func (c *Client) redact(err error) error {
+	var urlErr *url.Error
+	if c.APIKey == "" || !errors.As(err, &urlErr) {
+		return err
+	}
+
+	urlErr.URL = strings.ReplaceAll(urlErr.URL, url.QueryEscape(c.APIKey), redactedKey)
+	urlErr.URL = strings.ReplaceAll(urlErr.URL, c.APIKey, redactedKey)
+	return err
+}
+
+// parseQuota reads the X-RateLimit-* headers, falling back to the rate block
+// of the body. It returns nil if neither is present.
+func parseQuota(header http.Header, rate *Rate) *Quota {
+	quota := &Quota{UpdatedAt: time.Now()}
+
+	limit, limitErr := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	remaining, remainingErr := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	reset, resetErr := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+
+	switch {
+	case limitErr == nil && remainingErr == nil && resetErr == nil:
+		quota.Limit, quota.Remaining = limit, remaining
+	case rate != nil:
+		quota.Limit, quota.Remaining = rate.Limit, rate.Remaining
+		reset = rate.Reset
+	default:
+		return nil
+	}
+
+	quota.Reset = time.Unix(reset, 0)
+	return quota
+}
@@ -0,0 +1,124 @@
+package opencage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientGeocode(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     map[string]string
+		statusCode int
+		response   string
+		wantStatus int
+		wantQuota  *Quota
+	}{
+		{
+			name:     "success without quota",
+			response: `{"results": [{"geometry": {"lat": 37.7749, "lng": -122.4194}}], "status": {"code": 200, "message": "OK"}}`,
+		},
+		{
+			name: "quota from headers",
+			header: map[string]string{
+				"X-RateLimit-Limit":     "2500",
+				"X-RateLimit-Remaining": "2400",
+				"X-RateLimit-Reset":     "1735084800",
+			},
+			response:  `{"results": [], "status": {"code": 200, "message": "OK"}, "rate": {"limit": 2500, "remaining": 9, "reset": 1}}`,
+			wantQuota: &Quota{Limit: 2500, Remaining: 2400, Reset: time.Unix(1735084800, 0)},
+		},
+		{
+			name:      "quota from rate block",
+			response:  `{"results": [], "status": {"code": 200, "message": "OK"}, "rate": {"limit": 2500, "remaining": 7, "reset": 1735084800}}`,
+			wantQuota: &Quota{Limit: 2500, Remaining: 7, Reset: time.Unix(1735084800, 0)},
+		},
+		{
+			name:       "error in status block",
+			response:   `{"results": [], "status": {"code": 402, "message": "quota exceeded"}, "rate": {"limit": 2500, "remaining": 0, "reset": 1735084800}}`,
+			wantStatus: http.StatusPaymentRequired,
+			wantQuota:  &Quota{Limit: 2500, Remaining: 0, Reset: time.Unix(1735084800, 0)},
+		},
+		{
+			name:       "error status with html body",
+			statusCode: http.StatusBadGateway,
+			response:   `<html><body>502 Bad Gateway</body></html>`,
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				if tt.statusCode != 0 {
+					w.WriteHeader(tt.statusCode)
+				}
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.Client(), "test-key")
+			client.BaseURL = server.URL
+
+			_, err := client.Geocode(context.Background(), "123 Main St")
+
+			var statusErr *StatusError
+			if tt.wantStatus != 0 {
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+					t.Fatalf("Geocode() error = %v, want *StatusError with status %d", err, tt.wantStatus)
+				}
+			} else if err != nil {
+				t.Fatalf("Geocode() error = %v", err)
+			}
+
+			quota, ok := client.Quota()
+			if ok != (tt.wantQuota != nil) {
+				t.Fatalf("Quota() = %+v, %v, want reported %v", quota, ok, tt.wantQuota != nil)
+			}
+			if ok && (quota.Limit != tt.wantQuota.Limit || quota.Remaining != tt.wantQuota.Remaining || !quota.Reset.Equal(tt.wantQuota.Reset)) {
+				t.Errorf("Quota() = %+v, want %+v", quota, *tt.wantQuota)
+			}
+			if statusErr != nil && ok && statusErr.Quota == nil {
+				t.Error("StatusError.Quota = nil, want the reported quota")
+			}
+		})
+	}
+}
+
+func TestClientRedactsAPIKey(t *testing.T) {
+	const key = "s3cr3t/k+y"
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	tests := []struct {
+		name    string
+		baseURL string
+	}{
+		{name: "unreachable", baseURL: server.URL},
+		{name: "invalid url", baseURL: "http://bad host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(nil, key)
+			client.BaseURL = tt.baseURL
+
+			_, err := client.Geocode(context.Background(), "123 Main St")
+			if err == nil {
+				t.Fatal("Geocode() expected error")
+			}
+			if msg := err.Error(); strings.Contains(msg, "s3cr3t") || !strings.Contains(msg, "key="+redactedKey) {
+				t.Errorf("Geocode() error = %q, want the key redacted", msg)
+			}
+		})
+	}
+}
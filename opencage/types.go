@@ -64,8 +64,17 @@ type Status struct {
 	Message string `json:"message"`
 }
 
+// Rate is the daily quota block, only sent to accounts with a request limit.
+// Reset is a Unix timestamp.
+type Rate struct {
+	Limit     int   `json:"limit"`
+	Remaining int   `json:"remaining"`
+	Reset     int64 `json:"reset"`
+}
+
 // Response represents the complete OpenCage API response
 type Response struct {
 	Results []Result `json:"results"`
 	Status  Status   `json:"status"`
+	Rate    *Rate    `json:"rate,omitempty"`
 }
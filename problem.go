@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ssh-keyz/property-details/property"
+)
+
+// Stable error codes reported in problem responses. Clients branch on these,
+// so existing values must never change meaning.
+const (
+	codeMethodNotAllowed      = "method_not_allowed"
+	codeMissingAddress        = "missing_address"
+	codeMalformedAddress      = "malformed_address"
+	codeInvalidAddress        = "invalid_address"
+	codeAddressNotFound       = "address_not_found"
+	codeUpstreamTimeout       = "upstream_timeout"
+	codeUpstreamUnavailable   = "upstream_unavailable"
+	codeUpstreamRateLimited   = "upstream_rate_limited"
+	codeUpstreamQuotaExceeded = "upstream_quota_exceeded"
+	codeUpstreamAuthFailed    = "upstream_auth_failed"
+	codeUnauthorized          = "unauthorized"
+	codeMalformedBatch        = "malformed_batch"
+	codeEmptyBatch            = "empty_batch"
+	codeBatchTooLarge         = "batch_too_large"
+	codeInternal              = "internal_error"
+)
+
+// problem is an RFC 7807 problem details body. Type is always about:blank, so
+// Title is the status text and Code identifies the problem.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+
+	retryAfter time.Duration
+}
+
+func newProblem(status int, code, detail string) *problem {
+	return &problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func writeProblem(w http.ResponseWriter, p *problem) {
+	if p.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(p.retryAfter.Seconds()))))
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// problemFor maps an error from the property service to a problem. Outages
+// with a known retry time are reported as 503 with Retry-After, others as 502.
+func problemFor(err error) *problem {
+	var (
+		p           *problem
+		upstreamErr *property.UpstreamError
+		rateErr     *property.RateLimitError
+		circuitErr  *property.CircuitOpenError
+	)
+
+	switch {
+	case errors.Is(err, property.ErrInvalidAddress):
+		return newProblem(http.StatusUnprocessableEntity, codeInvalidAddress, err.Error())
+	case errors.Is(err, property.ErrAddressNotFound):
+		return newProblem(http.StatusNotFound, codeAddressNotFound, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return newProblem(http.StatusGatewayTimeout, codeUpstreamTimeout, err.Error())
+	case errors.As(err, &circuitErr):
+		p = newProblem(http.StatusServiceUnavailable, codeUpstreamUnavailable, err.Error())
+		p.retryAfter = circuitErr.RetryAfter
+	case errors.As(err, &rateErr):
+		p = newProblem(http.StatusServiceUnavailable, codeUpstreamRateLimited, err.Error())
+		p.retryAfter = rateErr.Wait
+	case errors.Is(err, property.ErrInvalidAPIKey):
+		return newProblem(http.StatusBadGateway, codeUpstreamAuthFailed, err.Error())
+	case errors.As(err, &upstreamErr):
+		code := codeUpstreamUnavailable
+		switch {
+		case errors.Is(upstreamErr, property.ErrQuotaExceeded):
+			code = codeUpstreamQuotaExceeded
+		case upstreamErr.StatusCode == http.StatusTooManyRequests:
+			// The provider is throttling us rather than down
+			code = codeUpstreamRateLimited
+		}
+		p = newProblem(http.StatusBadGateway, code, err.Error())
+		if upstreamErr.RetryAfter > 0 {
+			p.Status = http.StatusServiceUnavailable
+			p.Title = http.StatusText(p.Status)
+			p.retryAfter = upstreamErr.RetryAfter
+		}
+	case errors.Is(err, property.ErrUpstreamUnavailable):
+		return newProblem(http.StatusBadGateway, codeUpstreamUnavailable, err.Error())
+	default:
+		return newProblem(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	return p
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ssh-keyz/property-details/property"
+)
+
+func TestProblemFor(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantCode       string
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:       "invalid address",
+			err:        fmt.Errorf("address validation failed: %w", &property.AddressError{Reason: "invalid address format"}),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   codeInvalidAddress,
+		},
+		{
+			name:       "address not found",
+			err:        errors.Join(&property.SectionError{Section: property.SectionGeocode, Err: property.ErrAddressNotFound}),
+			wantStatus: http.StatusNotFound,
+			wantCode:   codeAddressNotFound,
+		},
+		{
+			name:       "timeout",
+			err:        fmt.Errorf("overpass: %w", context.DeadlineExceeded),
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   codeUpstreamTimeout,
+		},
+		{
+			name:           "circuit open",
+			err:            &property.CircuitOpenError{Provider: "overpass", RetryAfter: 1500 * time.Millisecond},
+			wantStatus:     http.StatusServiceUnavailable,
+			wantCode:       codeUpstreamUnavailable,
+			wantRetryAfter: 2 * time.Second,
+		},
+		{
+			name:           "rate limited",
+			err:            &url.Error{Op: "Get", URL: "https://nominatim.openstreetmap.org/search", Err: &property.RateLimitError{Host: "nominatim.openstreetmap.org", Wait: 3 * time.Second}},
+			wantStatus:     http.StatusServiceUnavailable,
+			wantCode:       codeUpstreamRateLimited,
+			wantRetryAfter: 3 * time.Second,
+		},
+		{
+			name:       "upstream error status",
+			err:        &property.UpstreamError{Provider: "overpass", StatusCode: http.StatusBadGateway, Err: property.ErrUpstreamUnavailable},
+			wantStatus: http.StatusBadGateway,
+			wantCode:   codeUpstreamUnavailable,
+		},
+		{
+			name:           "upstream error with retry-after",
+			err:            &property.UpstreamError{Provider: "overpass", StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Minute, Err: property.ErrUpstreamUnavailable},
+			wantStatus:     http.StatusServiceUnavailable,
+			wantCode:       codeUpstreamUnavailable,
+			wantRetryAfter: time.Minute,
+		},
+		{
+			name:           "upstream throttling with retry-after",
+			err:            &property.UpstreamError{Provider: "overpass", StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute, Err: property.ErrUpstreamUnavailable},
+			wantStatus:     http.StatusServiceUnavailable,
+			wantCode:       codeUpstreamRateLimited,
+			wantRetryAfter: time.Minute,
+		},
+		{
+			name:       "upstream throttling",
+			err:        fmt.Errorf("failed to fetch schools: %w", &property.UpstreamError{Provider: "overpass", StatusCode: http.StatusTooManyRequests, Err: property.ErrUpstreamUnavailable}),
+			wantStatus: http.StatusBadGateway,
+			wantCode:   codeUpstreamRateLimited,
+		},
+		{
+			name:       "quota exceeded",
+			err:        &property.UpstreamError{Provider: "opencage", StatusCode: http.StatusPaymentRequired, Err: property.ErrQuotaExceeded},
+			wantStatus: http.StatusBadGateway,
+			wantCode:   codeUpstreamQuotaExceeded,
+		},
+		{
+			name:       "invalid api key",
+			err:        &property.UpstreamError{Provider: "opencage", StatusCode: http.StatusUnauthorized, Err: property.ErrInvalidAPIKey},
+			wantStatus: http.StatusBadGateway,
+			wantCode:   codeUpstreamAuthFailed,
+		},
+		{
+			name:       "unreachable",
+			err:        fmt.Errorf("%w: connection refused", property.ErrUpstreamUnavailable),
+			wantStatus: http.StatusBadGateway,
+			wantCode:   codeUpstreamUnavailable,
+		},
+		{
+			name:       "unknown",
+			err:        errors.New("boom"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   codeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeProblem(w, problemFor(tt.err))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", got)
+			}
+
+			wantRetryAfter := ""
+			if tt.wantRetryAfter > 0 {
+				wantRetryAfter = fmt.Sprint(int(tt.wantRetryAfter.Seconds()))
+			}
+			if got := w.Header().Get("Retry-After"); got != wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, wantRetryAfter)
+			}
+
+			var body problem
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode problem: %v", err)
+			}
+			if body.Code != tt.wantCode || body.Status != tt.wantStatus || body.Title != http.StatusText(tt.wantStatus) || body.Type != "about:blank" {
+				t.Errorf("problem = %+v, want code %s with status %d", body, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleGetPropertyProblems(t *testing.T) {
+	server := &Server{
+		service: newTestService(t),
+	}
+
+	// Neither Nominatim nor OpenCage know the address
+	nowhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/search":
+			w.Write([]byte(`[]`))
+		default:
+			w.Write([]byte(`{"results": [], "status": {"code": 200}}`))
+		}
+	}))
+	defer nowhere.Close()
+	geocoder := property.NewNominatimGeocoder(nil)
+	geocoder.BaseURL = nowhere.URL + "/search"
+	notFoundServer := &Server{
+		service: newTestService(t, property.WithGeocoder(geocoder), property.WithOpenCageURL(nowhere.URL)),
+	}
+
+	tests := []struct {
+		name       string
+		server     *Server
+		method     string
+		target     string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "missing address", method: http.MethodGet, target: "/property", wantStatus: http.StatusBadRequest, wantCode: codeMissingAddress},
+		{name: "malformed encoding", method: http.MethodGet, target: "/property?address=100%25zz", wantStatus: http.StatusBadRequest, wantCode: codeMalformedAddress},
+		{name: "invalid address", method: http.MethodGet, target: "/property?address=nowhere", wantStatus: http.StatusUnprocessableEntity, wantCode: codeInvalidAddress},
+		{name: "wrong method", method: http.MethodPost, target: "/property?address=nowhere", wantStatus: http.StatusMethodNotAllowed, wantCode: codeMethodNotAllowed},
+		{name: "address not found", server: notFoundServer, method: http.MethodGet, target: "/property?address=" + url.QueryEscape("1 Nowhere Lane, Springfield, IL 62701"), wantStatus: http.StatusNotFound, wantCode: codeAddressNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := server
+			if tt.server != nil {
+				server = tt.server
+			}
+			w := httptest.NewRecorder()
+			server.handleGetProperty(w, httptest.NewRequest(tt.method, tt.target, nil))
+
+			var body problem
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode problem: %v", err)
+			}
+			if w.Code != tt.wantStatus || body.Code != tt.wantCode {
+				t.Errorf("handleGetProperty() = %d %+v, want %d with code %s", w.Code, body, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
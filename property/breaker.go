@@ -0,0 +1,212 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen matches every *CircuitOpenError
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerState is the state of a provider's circuit breaker
+type BreakerState string
+
+// Circuit breaker states
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerConfig controls when a provider's circuit breaker trips
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// breaker. Zero disables circuit breaking.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting a single
+	// probe request through
+	OpenTimeout time.Duration
+}
+
+// DefaultBreakerConfig is the breaker configuration used by NewService
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+}
+
+// CircuitOpenError is returned without contacting Provider while its breaker
+// is open. RetryAfter estimates when the next probe will be allowed.
+type CircuitOpenError struct {
+	Provider   string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s unavailable: circuit breaker open", e.Provider)
+}
+
+// Is makes errors.Is(err, ErrCircuitOpen) match
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerStatus reports the state of one provider's circuit breaker
+type BreakerStatus struct {
+	State    BreakerState `json:"state"`
+	Failures int          `json:"consecutive_failures"`
+	OpenedAt *time.Time   `json:"opened_at,omitempty"`
+}
+
+// circuitBreaker fails calls to a provider fast after repeated failures. Once
+// OpenTimeout has passed it goes half-open and lets one probe through; the
+// probe's outcome closes or reopens it.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	provider string
+	cfg      BreakerConfig
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	nowFunc  func() time.Time
+}
+
+func newCircuitBreaker(provider string, cfg BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{
+		provider: provider,
+		cfg:      cfg,
+		state:    BreakerClosed,
+		nowFunc:  time.Now,
+	}
+}
+
+// allow reports whether a call may proceed. Every allowed call must be
+// followed by record.
+func (b *circuitBreaker) allow() error {
+	if b.cfg.FailureThreshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		remaining := b.cfg.OpenTimeout - b.nowFunc().Sub(b.openedAt)
+		if remaining > 0 {
+			return &CircuitOpenError{Provider: b.provider, RetryAfter: remaining}
+		}
+		b.state = BreakerHalfOpen
+	}
+
+	if b.state == BreakerHalfOpen {
+		if b.probing {
+			return &CircuitOpenError{Provider: b.provider, RetryAfter: b.cfg.OpenTimeout}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of an allowed call. Errors that
+// say nothing about the provider's health, such as the caller going away or a
+// local rate limit, leave the breaker as it was.
+func (b *circuitBreaker) record(err error) {
+	if b.cfg.FailureThreshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasProbe := b.state == BreakerHalfOpen && b.probing
+	b.probing = false
+
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, ErrRateLimited):
+		return
+	case err == nil || errors.Is(err, ErrAddressNotFound):
+		b.state = BreakerClosed
+		b.failures = 0
+	default:
+		b.failures++
+		if wasProbe || b.failures >= b.cfg.FailureThreshold {
+			b.state = BreakerOpen
+			b.openedAt = b.nowFunc()
+		}
+	}
+}
+
+func (b *circuitBreaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: b.state, Failures: b.failures}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// breakerSet holds one circuit breaker per provider, created on first use
+type breakerSet struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	breakers map[string]*circuitBreaker
+}
+
+func newBreakerSet(cfg BreakerConfig) *breakerSet {
+	return &breakerSet{cfg: cfg, breakers: make(map[string]*circuitBreaker)}
+}
+
+func (s *breakerSet) get(provider string) *circuitBreaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[provider]
+	if !ok {
+		b = newCircuitBreaker(provider, s.cfg)
+		s.breakers[provider] = b
+	}
+	return b
+}
+
+// adopt shares the breaker of provider in other, if it has one, so that
+// both sets see the same state
+func (s *breakerSet) adopt(other *breakerSet, provider string) {
+	other.mu.Lock()
+	b, ok := other.breakers[provider]
+	other.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakers[provider] = b
+}
+
+func (s *breakerSet) status() map[string]BreakerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := make(map[string]BreakerStatus, len(s.breakers))
+	for provider, b := range s.breakers {
+		status[provider] = b.status()
+	}
+	return status
+}
+
+// call runs fn through the provider's breaker
+func (s *breakerSet) call(provider string, fn func() error) error {
+	b := s.get(provider)
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
@@ -0,0 +1,184 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	upstreamErr := errors.New("503 Service Unavailable")
+
+	newBreaker := func() (*circuitBreaker, *time.Time) {
+		now := time.Now()
+		b := newCircuitBreaker("example", BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+		b.nowFunc = func() time.Time { return now }
+		return b, &now
+	}
+
+	t.Run("opens after consecutive failures", func(t *testing.T) {
+		b, _ := newBreaker()
+		for i := 0; i < 2; i++ {
+			if err := b.allow(); err != nil {
+				t.Fatalf("allow() before threshold error = %v", err)
+			}
+			b.record(upstreamErr)
+		}
+
+		err := b.allow()
+		var openErr *CircuitOpenError
+		if !errors.As(err, &openErr) || openErr.Provider != "example" || openErr.RetryAfter != time.Minute {
+			t.Fatalf("allow() error = %v, want *CircuitOpenError retrying in 1m", err)
+		}
+		if !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("allow() error = %v, want ErrCircuitOpen", err)
+		}
+		if status := b.status(); status.State != BreakerOpen || status.OpenedAt == nil {
+			t.Errorf("status() = %+v, want open", status)
+		}
+	})
+
+	t.Run("success resets the failure count", func(t *testing.T) {
+		b, _ := newBreaker()
+		b.allow()
+		b.record(upstreamErr)
+		b.allow()
+		b.record(nil)
+		b.allow()
+		b.record(upstreamErr)
+
+		if status := b.status(); status.State != BreakerClosed || status.Failures != 1 {
+			t.Errorf("status() = %+v, want closed with 1 failure", status)
+		}
+	})
+
+	t.Run("neutral errors are not counted", func(t *testing.T) {
+		b, _ := newBreaker()
+		for _, err := range []error{context.Canceled, &RateLimitError{Host: "example.com"}, ErrAddressNotFound, context.Canceled} {
+			b.allow()
+			b.record(err)
+		}
+
+		if status := b.status(); status.State != BreakerClosed || status.Failures != 0 {
+			t.Errorf("status() = %+v, want closed with no failures", status)
+		}
+	})
+
+	t.Run("half-open allows a single probe", func(t *testing.T) {
+		b, now := newBreaker()
+		for i := 0; i < 2; i++ {
+			b.allow()
+			b.record(upstreamErr)
+		}
+
+		*now = now.Add(time.Minute + time.Second)
+		if err := b.allow(); err != nil {
+			t.Fatalf("allow() probe error = %v", err)
+		}
+		if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("allow() during probe error = %v, want ErrCircuitOpen", err)
+		}
+		if state := b.status().State; state != BreakerHalfOpen {
+			t.Errorf("state during probe = %q, want half-open", state)
+		}
+
+		b.record(nil)
+		if status := b.status(); status.State != BreakerClosed || status.Failures != 0 {
+			t.Errorf("status() after successful probe = %+v, want closed", status)
+		}
+	})
+
+	t.Run("failed probe reopens", func(t *testing.T) {
+		b, now := newBreaker()
+		for i := 0; i < 2; i++ {
+			b.allow()
+			b.record(upstreamErr)
+		}
+
+		*now = now.Add(time.Minute + time.Second)
+		b.allow()
+		b.record(upstreamErr)
+
+		status := b.status()
+		if status.State != BreakerOpen || !status.OpenedAt.Equal(*now) {
+			t.Errorf("status() after failed probe = %+v, want reopened at %v", status, *now)
+		}
+	})
+
+	t.Run("zero threshold disables", func(t *testing.T) {
+		b := newCircuitBreaker("example", BreakerConfig{})
+		for i := 0; i < 10; i++ {
+			if err := b.allow(); err != nil {
+				t.Fatalf("allow() error = %v", err)
+			}
+			b.record(upstreamErr)
+		}
+	})
+}
+
+func TestGetInfoServesStaleWhenCircuitOpen(t *testing.T) {
+	var down atomic.Bool
+	var requests atomic.Int32
+	details := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if down.Load() {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"results": [{"components": {"type": "residential", "building": "house"}}], "status": {"code": 200}}`))
+	}))
+	defer details.Close()
+
+	schools := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"elements": []}`))
+	}))
+	defer schools.Close()
+
+	service := NewService(
+		WithGeocoder(&stubGeocoder{coords: &Coordinates{Lat: 37.7749, Lon: -122.4194}}),
+		WithOpenCageURL(details.URL),
+		WithOverpassURL(schools.URL),
+		WithRetryPolicy(RetryPolicy{}),
+		WithCache(CacheConfig{Size: 10, GeocodeTTL: time.Hour, DetailsTTL: time.Millisecond, SchoolsTTL: time.Hour}),
+		WithBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}),
+	)
+
+	const address = "123 Main St, San Francisco, CA 94105"
+	if info, err := service.GetInfo(address); err != nil || !info.Complete() {
+		t.Fatalf("first GetInfo() = %+v, %v, want complete result", info, err)
+	}
+
+	down.Store(true)
+	time.Sleep(5 * time.Millisecond)
+
+	// The details entry has expired, so the outage trips the breaker
+	info, err := service.GetInfo(address)
+	if err != nil {
+		t.Fatalf("second GetInfo() error = %v", err)
+	}
+	if len(info.Errors) != 1 || info.Errors[0].Section != SectionDetails {
+		t.Fatalf("second GetInfo().Errors = %+v, want details only", info.Errors)
+	}
+
+	// With the breaker open the expired entry stands in for the details
+	info, err = service.GetInfo(address)
+	if err != nil {
+		t.Fatalf("third GetInfo() error = %v", err)
+	}
+	if !info.Complete() || info.Details == nil || info.Details.Size == "" {
+		t.Fatalf("third GetInfo() = %+v, details %+v, want stale details", info, info.Details)
+	}
+	if len(info.Warnings) != 1 || info.Warnings[0].Section != SectionDetails || !errors.Is(info.Warnings[0].Err, ErrCircuitOpen) {
+		t.Errorf("third GetInfo().Warnings = %+v, want stale details warning", info.Warnings)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("details requests = %d, want 2", got)
+	}
+	if state := service.Breakers()[ProviderOpenCage].State; state != BreakerOpen {
+		t.Errorf("opencage breaker = %q, want open", state)
+	}
+}
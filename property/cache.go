@@ -0,0 +1,287 @@
+package property
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheConfig bounds the in-memory lookup cache. Each section keeps at most
+// Size entries, and a zero TTL disables caching for that section.
+type CacheConfig struct {
+	Size       int
+	GeocodeTTL time.Duration
+	DetailsTTL time.Duration
+	SchoolsTTL time.Duration
+}
+
+// DefaultCacheConfig is the cache configuration used by NewService.
+// Coordinates and nearby schools rarely change, so they are kept longer than
+// property details.
+var DefaultCacheConfig = CacheConfig{
+	Size:       1000,
+	GeocodeTTL: 24 * time.Hour,
+	DetailsTTL: 6 * time.Hour,
+	SchoolsTTL: 24 * time.Hour,
+}
+
+// CacheStats reports the activity of one section of the lookup cache.
+// Store counters only move on in-memory misses.
+type CacheStats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Entries     int    `json:"entries"`
+	StoreHits   uint64 `json:"store_hits"`
+	StoreMisses uint64 `json:"store_misses"`
+}
+
+// Store persists lookup results so they survive process restarts. It is
+// consulted after the in-memory cache misses. Values are JSON encoded.
+type Store interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// lookupCache holds the per-section caches of a Service
+type lookupCache struct {
+	geocodes *sectionCache[Coordinates]
+	details  *sectionCache[Details]
+	schools  *sectionCache[[]School]
+}
+
+// newLookupCache builds the section caches. Only geocodes and schools are
+// persisted to store, since details are cheap to refresh and change often.
+func newLookupCache(cfg CacheConfig, store Store) *lookupCache {
+	return &lookupCache{
+		geocodes: newSectionCache[Coordinates](SectionGeocode, cfg.Size, cfg.GeocodeTTL, store),
+		details:  newSectionCache[Details](SectionDetails, cfg.Size, cfg.DetailsTTL, nil),
+		schools:  newSectionCache[[]School](SectionSchools, cfg.Size, cfg.SchoolsTTL, store),
+	}
+}
+
+func (c *lookupCache) stats() map[Section]CacheStats {
+	return map[Section]CacheStats{
+		SectionGeocode: c.geocodes.stats(),
+		SectionDetails: c.details.stats(),
+		SectionSchools: c.schools.stats(),
+	}
+}
+
+// sectionCache layers an optional persistent Store beneath an in-memory LRU
+type sectionCache[V any] struct {
+	section     Section
+	mem         *lruCache[V]
+	store       Store
+	ttl         time.Duration
+	storeHits   atomic.Uint64
+	storeMisses atomic.Uint64
+}
+
+func newSectionCache[V any](section Section, size int, ttl time.Duration, store Store) *sectionCache[V] {
+	if ttl <= 0 {
+		store = nil
+	}
+	return &sectionCache[V]{
+		section: section,
+		mem:     newLRUCache[V](size, ttl),
+		store:   store,
+		ttl:     ttl,
+	}
+}
+
+func (c *sectionCache[V]) storeKey(key string) string {
+	return string(c.section) + ":" + key
+}
+
+func (c *sectionCache[V]) get(key string) (V, bool) {
+	if value, ok := c.mem.get(key); ok {
+		return value, true
+	}
+
+	var value V
+	if c.store == nil {
+		return value, false
+	}
+
+	data, ok := c.store.Get(c.storeKey(key))
+	if !ok || json.Unmarshal(data, &value) != nil {
+		c.storeMisses.Add(1)
+		return value, false
+	}
+
+	c.storeHits.Add(1)
+	c.mem.set(key, value)
+	return value, true
+}
+
+// set caches value in memory and in the store. The in-memory entry is kept
+// even if persisting it fails.
+func (c *sectionCache[V]) set(key string, value V) error {
+	c.mem.set(key, value)
+	if c.store == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = c.store.Set(c.storeKey(key), data, c.ttl)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to persist %s cache entry: %w", c.section, err)
+	}
+	return nil
+}
+
+// staleFallback finds an expired entry to stand in for a section whose
+// provider's circuit breaker is open
+func (c *sectionCache[V]) staleFallback(key string, err error) (V, bool) {
+	if !errors.Is(err, ErrCircuitOpen) {
+		var zero V
+		return zero, false
+	}
+	return c.mem.getStale(key)
+}
+
+func (c *sectionCache[V]) stats() CacheStats {
+	stats := c.mem.stats()
+	stats.StoreHits = c.storeHits.Load()
+	stats.StoreMisses = c.storeMisses.Load()
+	return stats
+}
+
+// normalizeAddress folds case, whitespace and comma spacing so that trivially
+// different spellings of an address share a cache entry
+func normalizeAddress(address string) string {
+	parts := strings.Split(address, ",")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.Join(strings.Fields(part), " "))
+	}
+	return strings.Join(parts, ",")
+}
+
+// coordinatesKey identifies a location to roughly one metre
+func coordinatesKey(coords *Coordinates) string {
+	return fmt.Sprintf("%.5f,%.5f", coords.Lat, coords.Lon)
+}
+
+// lruCache is a bounded least recently used cache whose entries expire after
+// a fixed TTL. A nil *lruCache is a valid, always empty cache.
+type lruCache[V any] struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	items   map[string]*list.Element
+	order   *list.List
+	hits    uint64
+	misses  uint64
+	nowFunc func() time.Time
+}
+
+type lruEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+func newLRUCache[V any](size int, ttl time.Duration) *lruCache[V] {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &lruCache[V]{
+		size:    size,
+		ttl:     ttl,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+		nowFunc: time.Now,
+	}
+}
+
+func (c *lruCache[V]) get(key string) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return zero, false
+	}
+
+	// Expired entries are kept until evicted so they can still be served
+	// stale while a provider is unavailable
+	entry := elem.Value.(*lruEntry[V])
+	if c.nowFunc().After(entry.expires) {
+		c.misses++
+		return zero, false
+	}
+
+	c.order.MoveToFront(elem)
+	c.hits++
+	return entry.value, true
+}
+
+// getStale returns the entry for key even if it has expired
+func (c *lruCache[V]) getStale(key string) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	return elem.Value.(*lruEntry[V]).value, true
+}
+
+func (c *lruCache[V]) set(key string, value V) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.nowFunc().Add(c.ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry[V])
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[V]).key)
+	}
+}
+
+func (c *lruCache[V]) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: c.order.Len(),
+	}
+}
@@ -0,0 +1,253 @@
+package property
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ssh-keyz/property-details/diskcache"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    string
+	}{
+		{
+			name:    "already normalized",
+			address: "123 main st,san francisco,ca 94105",
+			want:    "123 main st,san francisco,ca 94105",
+		},
+		{
+			name:    "case and comma spacing",
+			address: "123 Main St, San Francisco, CA 94105",
+			want:    "123 main st,san francisco,ca 94105",
+		},
+		{
+			name:    "repeated whitespace",
+			address: "  123  Main\tSt ,San   Francisco,  CA 94105 ",
+			want:    "123 main st,san francisco,ca 94105",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeAddress(tt.address); got != tt.want {
+				t.Errorf("normalizeAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	t.Run("evicts least recently used", func(t *testing.T) {
+		cache := newLRUCache[int](2, time.Hour)
+		cache.set("a", 1)
+		cache.set("b", 2)
+		cache.get("a")
+		cache.set("c", 3)
+
+		if _, ok := cache.get("b"); ok {
+			t.Error("get(b) hit, want evicted")
+		}
+		if v, ok := cache.get("a"); !ok || v != 1 {
+			t.Errorf("get(a) = %v, %v, want 1, true", v, ok)
+		}
+		if v, ok := cache.get("c"); !ok || v != 3 {
+			t.Errorf("get(c) = %v, %v, want 3, true", v, ok)
+		}
+	})
+
+	t.Run("expires after ttl", func(t *testing.T) {
+		now := time.Now()
+		cache := newLRUCache[int](2, time.Minute)
+		cache.nowFunc = func() time.Time { return now }
+		cache.set("a", 1)
+
+		now = now.Add(30 * time.Second)
+		if _, ok := cache.get("a"); !ok {
+			t.Error("get(a) missed before ttl")
+		}
+
+		now = now.Add(time.Minute)
+		if _, ok := cache.get("a"); ok {
+			t.Error("get(a) hit after ttl")
+		}
+		if v, ok := cache.getStale("a"); !ok || v != 1 {
+			t.Errorf("getStale(a) = %v, %v, want 1, true", v, ok)
+		}
+		if stats := cache.stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+			t.Errorf("stats() = %+v, want 1 hit, 1 miss, 1 entry", stats)
+		}
+	})
+
+	t.Run("disabled cache", func(t *testing.T) {
+		cache := newLRUCache[int](10, 0)
+		cache.set("a", 1)
+		if _, ok := cache.get("a"); ok {
+			t.Error("get(a) hit on disabled cache")
+		}
+		if stats := cache.stats(); stats != (CacheStats{}) {
+			t.Errorf("stats() = %+v, want zero", stats)
+		}
+	})
+}
+
+func TestGetInfoUsesCache(t *testing.T) {
+	var upstreamCalls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls.Add(1)
+		switch r.URL.Path {
+		case "/geocode":
+			w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200}}`))
+		case "/interpreter":
+			w.Write([]byte(`{"elements": []}`))
+		}
+	}))
+	defer upstream.Close()
+
+	geocoder := &stubGeocoder{coords: &Coordinates{Lat: 37.7749, Lon: -122.4194}}
+	service := NewService(
+		WithGeocoder(geocoder),
+		WithOpenCageURL(upstream.URL+"/geocode"),
+		WithOverpassURL(upstream.URL+"/interpreter"),
+	)
+
+	for _, address := range []string{
+		"123 Main St, San Francisco, CA 94105",
+		"123 main st,  san francisco, CA 94105",
+	} {
+		if _, err := service.GetInfo(address); err != nil {
+			t.Fatalf("GetInfo(%q) error = %v", address, err)
+		}
+	}
+
+	if geocoder.calls != 1 {
+		t.Errorf("geocoder called %d times, want 1", geocoder.calls)
+	}
+	if got := upstreamCalls.Load(); got != 2 {
+		t.Errorf("upstream called %d times, want 2", got)
+	}
+
+	stats := service.Stats()
+	for _, section := range allSections {
+		if got := stats.Cache[section]; got.Hits != 1 || got.Misses != 1 || got.Entries != 1 {
+			t.Errorf("Stats().Cache[%s] = %+v, want 1 hit, 1 miss, 1 entry", section, got)
+		}
+	}
+}
+
+func TestGetInfoStages(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/geocode":
+			w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200}}`))
+		case "/interpreter":
+			w.Write([]byte(`{"elements": []}`))
+		}
+	}))
+	defer upstream.Close()
+
+	service := NewService(
+		WithGeocoder(&stubGeocoder{coords: &Coordinates{Lat: 37.7749, Lon: -122.4194}}),
+		WithOpenCageURL(upstream.URL+"/geocode"),
+		WithOverpassURL(upstream.URL+"/interpreter"),
+	)
+
+	providers := map[Section]string{
+		SectionGeocode: "stub",
+		SectionDetails: ProviderOpenCage,
+		SectionSchools: ProviderOverpass,
+	}
+	for _, want := range []CacheStatus{CacheMiss, CacheHit} {
+		info, err := service.GetInfo("123 Main St, San Francisco, CA 94105")
+		if err != nil {
+			t.Fatalf("GetInfo() error = %v", err)
+		}
+		for _, section := range allSections {
+			stage, ok := info.Stages[section]
+			if !ok {
+				t.Fatalf("Stages = %+v, want %s", info.Stages, section)
+			}
+			if stage.Provider != providers[section] || stage.Cache != want {
+				t.Errorf("Stages[%s] = %+v, want provider %s, cache %s", section, stage, providers[section], want)
+			}
+			if want == CacheHit && stage.Upstream != 0 {
+				t.Errorf("Stages[%s].Upstream = %v on a cache hit, want 0", section, stage.Upstream)
+			}
+			if stage.Duration < stage.CacheTime+stage.Upstream {
+				t.Errorf("Stages[%s].Duration = %v, want at least cache %v + upstream %v", section, stage.Duration, stage.CacheTime, stage.Upstream)
+			}
+		}
+	}
+
+	failing := NewService(
+		WithGeocoder(&stubGeocoder{err: ErrAddressNotFound}),
+		WithOpenCageURL(upstream.URL+"/geocode"),
+		WithOverpassURL(upstream.URL+"/interpreter"),
+	)
+	info, _ := failing.GetInfo("123 Main St, San Francisco, CA 94105")
+	if _, ok := info.Stages[SectionSchools]; ok {
+		t.Errorf("Stages = %+v, want schools absent when skipped", info.Stages)
+	}
+}
+
+func TestGetInfoUsesStoreAcrossRestarts(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/geocode":
+			w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200}}`))
+		case "/interpreter":
+			w.Write([]byte(`{"elements": [{"type": "node", "lat": 37.775, "lon": -122.42, "tags": {"name": "Test School", "amenity": "school"}}]}`))
+		}
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "lookups.db")
+	address := "123 Main St, San Francisco, CA 94105"
+
+	lookup := func(geocoder *stubGeocoder, overpassURL string) (*Info, Stats) {
+		t.Helper()
+
+		store, err := diskcache.Open(path, diskcache.Options{})
+		if err != nil {
+			t.Fatalf("diskcache.Open() error = %v", err)
+		}
+		defer store.Close()
+
+		service := NewService(
+			WithGeocoder(geocoder),
+			WithOpenCageURL(upstream.URL+"/geocode"),
+			WithOverpassURL(overpassURL),
+			WithStore(store),
+		)
+		info, err := service.GetInfo(address)
+		if err != nil {
+			t.Fatalf("GetInfo() error = %v", err)
+		}
+		return info, service.Stats()
+	}
+
+	first := &stubGeocoder{coords: &Coordinates{Lat: 37.7749, Lon: -122.4194}}
+	lookup(first, upstream.URL+"/interpreter")
+
+	// A fresh service must answer geocode and schools from disk, without
+	// reaching the geocoder or a now unreachable Overpass
+	second := &stubGeocoder{err: errors.New("geocoder should not be called")}
+	info, stats := lookup(second, upstream.URL+"/unreachable")
+
+	if second.calls != 0 {
+		t.Errorf("geocoder called %d times after restart, want 0", second.calls)
+	}
+	if !info.Complete() || len(info.Schools) != 1 {
+		t.Errorf("GetInfo() = %+v, want complete result from store", info)
+	}
+	if stats.Cache[SectionGeocode].StoreHits != 1 || stats.Cache[SectionSchools].StoreHits != 1 {
+		t.Errorf("Stats().Cache = %+v, want one store hit for geocode and schools", stats.Cache)
+	}
+}
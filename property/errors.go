@@ -0,0 +1,101 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrInvalidAddress matches every *AddressError
+var ErrInvalidAddress = errors.New("invalid address")
+
+// AddressError is returned when an address fails validation
+type AddressError struct {
+	Reason string
+}
+
+func (e *AddressError) Error() string {
+	return e.Reason
+}
+
+// Is makes errors.Is(err, ErrInvalidAddress) match
+func (e *AddressError) Is(target error) bool {
+	return target == ErrInvalidAddress
+}
+
+// Provider errors, matched with errors.Is. Failures with an HTTP status are
+// reported as *UpstreamError, which wraps one of them.
+var (
+	// ErrAddressNotFound is returned when a provider has no match for an address
+	ErrAddressNotFound = errors.New("address not found")
+	// ErrUpstreamUnavailable is returned when a provider cannot be reached or
+	// answers with an error status
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	// ErrQuotaExceeded is returned when a provider refuses further requests
+	// until the account's quota resets
+	ErrQuotaExceeded = errors.New("upstream quota exceeded")
+	// ErrInvalidAPIKey is returned when OpenCage, the only provider taking a
+	// key, rejects the configured one
+	ErrInvalidAPIKey = errors.New("upstream rejected API key")
+)
+
+// UpstreamError is returned when a provider answers with a non-2xx status.
+// Err is ErrInvalidAPIKey, ErrQuotaExceeded or ErrUpstreamUnavailable.
+type UpstreamError struct {
+	Provider   string
+	StatusCode int
+	// Message is the provider's own explanation, if it gave one
+	Message string
+	// RetryAfter is the provider's Retry-After hint, or zero
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	msg := fmt.Sprintf("upstream returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// newUpstreamError classifies an error status from provider. A 401 or 403
+// is left as an outage here: from a keyless provider it means a policy
+// block, and only openCageError knows it to be about the key.
+func newUpstreamError(provider string, statusCode int, header http.Header, message string) *UpstreamError {
+	err := &UpstreamError{
+		Provider:   provider,
+		StatusCode: statusCode,
+		Message:    message,
+		RetryAfter: parseRetryAfter(header.Get("Retry-After"), time.Now()),
+		Err:        ErrUpstreamUnavailable,
+	}
+	if statusCode == http.StatusPaymentRequired {
+		err.Err = ErrQuotaExceeded
+	}
+	return err
+}
+
+// checkStatus returns an *UpstreamError if resp has a non-2xx status, so the
+// body is never decoded as a result
+func checkStatus(provider string, resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return newUpstreamError(provider, resp.StatusCode, resp.Header, "")
+}
+
+// transportError marks a failed round trip as an outage, unless the request
+// was abandoned by the caller or held back by the local rate limiter
+func transportError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRateLimited) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+}
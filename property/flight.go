@@ -0,0 +1,104 @@
+package property
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// flightGroup deduplicates concurrent lookups with the same key, in the style
+// of singleflight. The zero value is ready to use.
+//
+// The shared call runs on a context detached from the caller that started it,
+// so one client going away does not fail the others. It is cancelled once
+// every caller waiting on it has given up.
+type flightGroup[V any] struct {
+	mu     sync.Mutex
+	calls  map[string]*flightCall[V]
+	shared atomic.Uint64
+	active sync.WaitGroup
+}
+
+type flightCall[V any] struct {
+	done    chan struct{}
+	val     V
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do runs fn once for all concurrent callers using key. shared reports whether
+// this caller joined a call that was already in flight.
+func (g *flightGroup[V]) do(ctx context.Context, key string, fn func(context.Context) (V, error)) (val V, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall[V])
+	}
+
+	c, shared := g.calls[key]
+	if shared {
+		c.waiters++
+		g.shared.Add(1)
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &flightCall[V]{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		g.calls[key] = c
+
+		g.active.Add(1)
+		go func() {
+			defer g.active.Done()
+			c.val, c.err = fn(callCtx)
+			cancel()
+
+			g.mu.Lock()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, shared, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Nobody is left to use the result; later callers start afresh
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+
+		var zero V
+		return zero, shared, ctx.Err()
+	}
+}
+
+// lookupFlights holds the per-section flight groups of a Service
+type lookupFlights struct {
+	geocodes flightGroup[Coordinates]
+	details  flightGroup[Details]
+	schools  flightGroup[[]School]
+}
+
+// wait blocks until every call in flight has finished, including those whose
+// callers have all given up
+func (f *lookupFlights) wait() {
+	f.geocodes.active.Wait()
+	f.details.active.Wait()
+	f.schools.active.Wait()
+}
+
+func (f *lookupFlights) stats() map[Section]uint64 {
+	return map[Section]uint64{
+		SectionGeocode: f.geocodes.shared.Load(),
+		SectionDetails: f.details.shared.Load(),
+		SectionSchools: f.schools.shared.Load(),
+	}
+}
@@ -0,0 +1,241 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlightGroupCoalesces(t *testing.T) {
+	var (
+		group   flightGroup[int]
+		calls   atomic.Int32
+		release = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+
+	const callers = 5
+	results := make([]int, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, _ = group.do(context.Background(), "key", func(ctx context.Context) (int, error) {
+				calls.Add(1)
+				<-release
+				return 42, nil
+			})
+		}(i)
+	}
+
+	waitFor(t, func() bool { return group.shared.Load() == callers-1 })
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("fn called %d times, want 1", got)
+	}
+	for i, got := range results {
+		if got != 42 {
+			t.Errorf("caller %d got %d, want 42", i, got)
+		}
+	}
+
+	// Once the call has finished, the next caller starts a new one
+	group.do(context.Background(), "key", func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		return 0, nil
+	})
+	if got := calls.Load(); got != 2 {
+		t.Errorf("fn called %d times after completion, want 2", got)
+	}
+}
+
+func TestFlightGroupCancellation(t *testing.T) {
+	t.Run("remaining waiter keeps the call alive", func(t *testing.T) {
+		var group flightGroup[int]
+		release := make(chan struct{})
+		fn := func(ctx context.Context) (int, error) {
+			select {
+			case <-release:
+				return 42, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		firstErr := make(chan error, 1)
+		go func() {
+			_, _, err := group.do(ctx, "key", fn)
+			firstErr <- err
+		}()
+
+		waitFor(t, func() bool {
+			group.mu.Lock()
+			defer group.mu.Unlock()
+			return len(group.calls) == 1
+		})
+
+		secondVal := make(chan int, 1)
+		go func() {
+			val, _, _ := group.do(context.Background(), "key", fn)
+			secondVal <- val
+		}()
+		waitFor(t, func() bool { return group.shared.Load() == 1 })
+
+		cancel()
+		if err := <-firstErr; !errors.Is(err, context.Canceled) {
+			t.Errorf("first caller error = %v, want context.Canceled", err)
+		}
+
+		close(release)
+		if got := <-secondVal; got != 42 {
+			t.Errorf("second caller got %d, want 42", got)
+		}
+	})
+
+	t.Run("last waiter leaving cancels the call", func(t *testing.T) {
+		var group flightGroup[int]
+		cancelled := make(chan struct{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			group.do(ctx, "key", func(ctx context.Context) (int, error) {
+				<-ctx.Done()
+				close(cancelled)
+				return 0, ctx.Err()
+			})
+		}()
+
+		cancel()
+		<-done
+		select {
+		case <-cancelled:
+		case <-time.After(2 * time.Second):
+			t.Fatal("shared call was not cancelled after its only waiter left")
+		}
+	})
+}
+
+func TestGetInfoCoalescesConcurrentLookups(t *testing.T) {
+	var detailsCalls, schoolsCalls atomic.Int32
+	release := make(chan struct{})
+	releaseSchools := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/geocode":
+			detailsCalls.Add(1)
+			<-release
+			w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200}}`))
+		case "/interpreter":
+			schoolsCalls.Add(1)
+			<-releaseSchools
+			w.Write([]byte(`{"elements": []}`))
+		}
+	}))
+	defer upstream.Close()
+
+	var geocodeCalls atomic.Int32
+	geocoder := geocoderFunc(func(ctx context.Context, address string) (*Coordinates, error) {
+		geocodeCalls.Add(1)
+		<-release
+		return &Coordinates{Lat: 37.7749, Lon: -122.4194}, nil
+	})
+
+	service := NewService(
+		WithGeocoder(geocoder),
+		WithOpenCageURL(upstream.URL+"/geocode"),
+		WithOverpassURL(upstream.URL+"/interpreter"),
+	)
+
+	const callers = 4
+	var wg sync.WaitGroup
+	infos := make([]*Info, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			info, err := service.GetInfo("123 Main St, San Francisco, CA 94105")
+			if err != nil {
+				t.Errorf("GetInfo() error = %v", err)
+			}
+			infos[i] = info
+		}(i)
+	}
+
+	waitFor(t, func() bool {
+		stats := service.Stats()
+		return stats.Coalesced[SectionGeocode] == callers-1 && stats.Coalesced[SectionDetails] == callers-1
+	})
+	close(release)
+
+	waitFor(t, func() bool { return service.Stats().Coalesced[SectionSchools] == callers-1 })
+	close(releaseSchools)
+	wg.Wait()
+
+	if geocodeCalls.Load() != 1 || detailsCalls.Load() != 1 || schoolsCalls.Load() != 1 {
+		t.Errorf("upstream calls = geocode %d, details %d, schools %d, want 1 each",
+			geocodeCalls.Load(), detailsCalls.Load(), schoolsCalls.Load())
+	}
+
+	for _, section := range allSections {
+		statuses := make(map[CacheStatus]int)
+		for _, info := range infos {
+			if info != nil {
+				statuses[info.Stages[section].Cache]++
+			}
+		}
+		if statuses[CacheMiss] != 1 || statuses[CacheCoalesced] != callers-1 {
+			t.Errorf("%s cache statuses = %v, want 1 miss and %d coalesced", section, statuses, callers-1)
+		}
+	}
+}
+
+func TestServiceShutdownWaitsForFlights(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	geocoder := geocoderFunc(func(ctx context.Context, address string) (*Coordinates, error) {
+		close(started)
+		// Ignores cancellation, like a provider call that is slow to unwind
+		<-release
+		return &Coordinates{Lat: 37.7749, Lon: -122.4194}, nil
+	})
+	service := NewService(WithGeocoder(geocoder))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go service.geocodeAddress(ctx, "123 Main St, San Francisco, CA 94105", nil)
+	<-started
+	cancel()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelShutdown()
+	if err := service.Shutdown(shutdownCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() with a call in flight = %v, want context.DeadlineExceeded", err)
+	}
+
+	close(release)
+	if err := service.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() after the call finished = %v, want nil", err)
+	}
+}
@@ -0,0 +1,158 @@
+package property
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ssh-keyz/property-details/opencage"
+)
+
+// DefaultNominatimURL is the public Nominatim search endpoint
+const DefaultNominatimURL = "https://nominatim.openstreetmap.org/search"
+
+// Geocoder resolves a free-form address to coordinates
+type Geocoder interface {
+	// Name identifies the provider in errors and diagnostics
+	Name() string
+	Geocode(ctx context.Context, address string) (*Coordinates, error)
+}
+
+// NominatimGeocoder resolves addresses using the OpenStreetMap Nominatim API
+type NominatimGeocoder struct {
+	Client    *http.Client
+	BaseURL   string
+	UserAgent string
+}
+
+// NewNominatimGeocoder creates a geocoder for the public Nominatim endpoint
+func NewNominatimGeocoder(client *http.Client) *NominatimGeocoder {
+	return &NominatimGeocoder{
+		Client:    client,
+		BaseURL:   DefaultNominatimURL,
+		UserAgent: "PropertyInfoService/1.0",
+	}
+}
+
+// Name implements Geocoder
+func (g *NominatimGeocoder) Name() string {
+	return ProviderNominatim
+}
+
+// Geocode implements Geocoder
+func (g *NominatimGeocoder) Geocode(ctx context.Context, address string) (*Coordinates, error) {
+	endpoint := fmt.Sprintf(
+		"%s?q=%s&format=json&limit=1",
+		g.BaseURL, url.QueryEscape(address),
+	)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", g.UserAgent)
+
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(ProviderNominatim, resp); err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, ErrAddressNotFound
+	}
+
+	lat, err := strconv.ParseFloat(results[0].Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude value: %w", err)
+	}
+
+	lon, err := strconv.ParseFloat(results[0].Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude value: %w", err)
+	}
+
+	return &Coordinates{
+		Lat: lat,
+		Lon: lon,
+	}, nil
+}
+
+// OpenCageGeocoder resolves addresses using the OpenCage API
+type OpenCageGeocoder struct {
+	Client *opencage.Client
+}
+
+// NewOpenCageGeocoder creates a geocoder backed by the given OpenCage client.
+// A nil client is replaced with the service's own client by NewService.
+func NewOpenCageGeocoder(client *opencage.Client) *OpenCageGeocoder {
+	return &OpenCageGeocoder{Client: client}
+}
+
+// Name implements Geocoder
+func (g *OpenCageGeocoder) Name() string {
+	return ProviderOpenCage
+}
+
+// Geocode implements Geocoder
+func (g *OpenCageGeocoder) Geocode(ctx context.Context, address string) (*Coordinates, error) {
+	result, err := g.Client.Geocode(ctx, address)
+	if err != nil {
+		return nil, openCageError(err)
+	}
+
+	if len(result.Results) == 0 {
+		return nil, ErrAddressNotFound
+	}
+
+	geometry := result.Results[0].Geometry
+	if !AreValidCoordinates(geometry.Lat, geometry.Lng) {
+		return nil, fmt.Errorf("invalid coordinates (%f,%f)", geometry.Lat, geometry.Lng)
+	}
+
+	return &Coordinates{
+		Lat: geometry.Lat,
+		Lon: geometry.Lng,
+	}, nil
+}
+
+// openCageError translates an OpenCage client error into the package's
+// provider errors
+func openCageError(err error) error {
+	var statusErr *opencage.StatusError
+	if errors.As(err, &statusErr) {
+		upstreamErr := newUpstreamError(ProviderOpenCage, statusErr.StatusCode, statusErr.Header, statusErr.Message)
+		if statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden {
+			upstreamErr.Err = ErrInvalidAPIKey
+		}
+		// An exhausted quota comes back when the daily limit resets
+		if upstreamErr.RetryAfter == 0 && errors.Is(upstreamErr, ErrQuotaExceeded) && statusErr.Quota != nil {
+			upstreamErr.RetryAfter = max(time.Until(statusErr.Quota.Reset), 0)
+		}
+		return upstreamErr
+	}
+	return transportError(err)
+}
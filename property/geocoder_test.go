@@ -0,0 +1,234 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ssh-keyz/property-details/opencage"
+)
+
+// stubGeocoder is a local stand-in for a geocoding provider
+type stubGeocoder struct {
+	coords *Coordinates
+	err    error
+	calls  int
+}
+
+func (g *stubGeocoder) Name() string {
+	return "stub"
+}
+
+func (g *stubGeocoder) Geocode(ctx context.Context, address string) (*Coordinates, error) {
+	g.calls++
+	return g.coords, g.err
+}
+
+func TestNominatimGeocoder(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		statusCode int
+		wantErr    bool
+		wantErrIs  error
+	}{
+		{
+			name:       "successful geocoding",
+			response:   `[{"lat": "37.7749", "lon": "-122.4194"}]`,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "address not found",
+			response:   `[]`,
+			statusCode: http.StatusOK,
+			wantErr:    true,
+			wantErrIs:  ErrAddressNotFound,
+		},
+		{
+			name:       "invalid json",
+			response:   `invalid json`,
+			statusCode: http.StatusOK,
+			wantErr:    true,
+		},
+		{
+			name:       "bad gateway page",
+			response:   `<html><body>502 Bad Gateway</body></html>`,
+			statusCode: http.StatusBadGateway,
+			wantErr:    true,
+			wantErrIs:  ErrUpstreamUnavailable,
+		},
+		{
+			name:       "usage policy block",
+			response:   `<html><body>Access blocked</body></html>`,
+			statusCode: http.StatusForbidden,
+			wantErr:    true,
+			wantErrIs:  ErrUpstreamUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.Query().Get("q"); got != "123 Main St, San Francisco, CA 94105" {
+					t.Errorf("query = %q", got)
+				}
+				if r.Header.Get("User-Agent") == "" {
+					t.Error("missing User-Agent header")
+				}
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			geocoder := NewNominatimGeocoder(server.Client())
+			geocoder.BaseURL = server.URL + "/search"
+
+			coords, err := geocoder.Geocode(context.Background(), "123 Main St, San Francisco, CA 94105")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Geocode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("Geocode() error = %v, want %v", err, tt.wantErrIs)
+			}
+			// Nominatim takes no key, so it can never be the one rejected
+			if errors.Is(err, ErrInvalidAPIKey) {
+				t.Errorf("Geocode() error = %v, want no API key error from Nominatim", err)
+			}
+			if err == nil && (coords.Lat != 37.7749 || coords.Lon != -122.4194) {
+				t.Errorf("Geocode() = %+v", coords)
+			}
+		})
+	}
+}
+
+func TestNominatimGeocoderUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	geocoder := NewNominatimGeocoder(nil)
+	geocoder.BaseURL = server.URL + "/search"
+
+	_, err := geocoder.Geocode(context.Background(), "123 Main St, San Francisco, CA 94105")
+	if !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("Geocode() error = %v, want ErrUpstreamUnavailable", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = geocoder.Geocode(ctx, "123 Main St, San Francisco, CA 94105")
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("Geocode() with cancelled context error = %v, want only context.Canceled", err)
+	}
+}
+
+func TestOpenCageGeocoder(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		statusCode int
+		wantErr    bool
+		wantErrIs  error
+	}{
+		{
+			name:     "successful geocoding",
+			response: `{"results": [{"geometry": {"lat": 37.7749, "lng": -122.4194}}], "status": {"code": 200}}`,
+		},
+		{
+			name:      "no results",
+			response:  `{"results": [], "status": {"code": 200}}`,
+			wantErr:   true,
+			wantErrIs: ErrAddressNotFound,
+		},
+		{
+			name:     "invalid coordinates",
+			response: `{"results": [{"geometry": {"lat": 0, "lng": 0}}], "status": {"code": 200}}`,
+			wantErr:  true,
+		},
+		{
+			name:       "invalid key",
+			response:   `{"results": [], "status": {"code": 401, "message": "invalid API key"}}`,
+			statusCode: http.StatusUnauthorized,
+			wantErr:    true,
+			wantErrIs:  ErrInvalidAPIKey,
+		},
+		{
+			name:       "quota exceeded",
+			response:   `{"results": [], "status": {"code": 402, "message": "quota exceeded"}}`,
+			statusCode: http.StatusPaymentRequired,
+			wantErr:    true,
+			wantErrIs:  ErrQuotaExceeded,
+		},
+		{
+			name:       "service unavailable page",
+			response:   `<html><body>503 Service Unavailable</body></html>`,
+			statusCode: http.StatusServiceUnavailable,
+			wantErr:    true,
+			wantErrIs:  ErrUpstreamUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.Query().Get("key"); got != "test-key" {
+					t.Errorf("key = %q, want test-key", got)
+				}
+				if tt.statusCode != 0 {
+					w.WriteHeader(tt.statusCode)
+				}
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			client := opencage.NewClient(server.Client(), "test-key")
+			client.BaseURL = server.URL
+
+			coords, err := NewOpenCageGeocoder(client).Geocode(context.Background(), "123 Main St, San Francisco, CA 94105")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Geocode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("Geocode() error = %v, want %v", err, tt.wantErrIs)
+			}
+			var upstreamErr *UpstreamError
+			if tt.statusCode != 0 && (!errors.As(err, &upstreamErr) || upstreamErr.Provider != ProviderOpenCage || upstreamErr.StatusCode != tt.statusCode) {
+				t.Errorf("Geocode() error = %#v, want *UpstreamError from opencage with status %d", err, tt.statusCode)
+			}
+			if err == nil && (coords.Lat != 37.7749 || coords.Lon != -122.4194) {
+				t.Errorf("Geocode() = %+v", coords)
+			}
+		})
+	}
+}
+
+func TestNewServiceGeocoderOption(t *testing.T) {
+	t.Run("defaults to nominatim", func(t *testing.T) {
+		service := NewService()
+		if got := service.geocoder.Name(); got != "nominatim" {
+			t.Errorf("default geocoder = %q, want nominatim", got)
+		}
+	})
+
+	t.Run("opencage geocoder shares the service client", func(t *testing.T) {
+		geocoder := NewOpenCageGeocoder(nil)
+		service := NewService(WithGeocoder(geocoder), WithOpenCageAPIKey("test-key"))
+		if geocoder.Client != service.openCage {
+			t.Error("OpenCage geocoder was not given the service client")
+		}
+	})
+
+	t.Run("custom geocoder is used", func(t *testing.T) {
+		stub := &stubGeocoder{err: errors.New("boom")}
+		service := NewService(WithGeocoder(stub))
+
+		_, err := service.geocodeAddress(context.Background(), "123 Main St, San Francisco, CA 94105", nil)
+		if err == nil || stub.calls != 1 {
+			t.Fatalf("geocodeAddress() error = %v, calls = %d", err, stub.calls)
+		}
+		if err.Error() != "stub: boom" {
+			t.Errorf("geocodeAddress() error = %q, want provider prefix", err)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package property
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying id, which is attached
+// to every log record the service writes while handling a lookup with it
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// contextLogger annotates logger with the request ID carried by ctx
+func contextLogger(ctx context.Context, logger *slog.Logger) *slog.Logger {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		return logger.With("request_id", id)
+	}
+	return logger
+}
+
+// logStage records how long a lookup stage took and whether it failed
+func (s *Service) logStage(ctx context.Context, section Section, start time.Time, err error) {
+	logger := contextLogger(ctx, s.logger)
+	duration := time.Since(start)
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelWarn, "Lookup stage failed",
+			slog.String("section", string(section)),
+			slog.Duration("duration", duration),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	logger.LogAttrs(ctx, slog.LevelDebug, "Lookup stage finished",
+		slog.String("section", string(section)),
+		slog.Duration("duration", duration),
+	)
+}
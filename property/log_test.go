@@ -0,0 +1,62 @@
+package property
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetInfoLogsStages(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"elements": [{"type": "way", "tags": {"name": "Nowhere School", "amenity": "school"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200}}`))
+	}))
+	defer upstream.Close()
+
+	var logs bytes.Buffer
+	service := NewService(
+		WithGeocoder(&stubGeocoder{coords: &Coordinates{Lat: 37.7749, Lon: -122.4194}}),
+		WithOpenCageURL(upstream.URL),
+		WithOverpassURL(upstream.URL),
+		WithLogger(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+
+	ctx := ContextWithRequestID(context.Background(), "req-123")
+	if _, err := service.GetInfoContext(ctx, "123 Main St, San Francisco, CA 94105"); err != nil {
+		t.Fatalf("GetInfoContext() error = %v", err)
+	}
+
+	stages := make(map[string]bool)
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		var record map[string]any
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("Failed to decode log record: %v", err)
+		}
+		if record["request_id"] != "req-123" {
+			t.Errorf("log record %v is missing the request ID", record)
+		}
+		if record["msg"] == "Lookup stage finished" {
+			if _, ok := record["duration"].(float64); !ok {
+				t.Errorf("stage record %v is missing its duration", record)
+			}
+			stages[record["section"].(string)] = true
+		}
+		if record["msg"] == "Skipping school without coordinates" && record["level"] != "DEBUG" {
+			t.Errorf("skipped school logged at %v, want DEBUG", record["level"])
+		}
+	}
+
+	for _, section := range allSections {
+		if !stages[string(section)] {
+			t.Errorf("no stage record for %s", section)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package property
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ssh-keyz/property-details/tracing"
+)
+
+// Option configures a Service
+type Option func(*Service)
+
+// WithHTTPClient sets the HTTP client used for all upstream requests
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Service) {
+		s.httpClient = client
+	}
+}
+
+// WithGeocoder sets the provider used to resolve addresses to coordinates
+func WithGeocoder(geocoder Geocoder) Option {
+	return func(s *Service) {
+		s.geocoder = geocoder
+	}
+}
+
+// WithOpenCageURL overrides the OpenCage endpoint used for property details
+func WithOpenCageURL(endpoint string) Option {
+	return func(s *Service) {
+		s.openCageURL = endpoint
+	}
+}
+
+// WithOpenCageAPIKey overrides the OpenCage key read from OPENCAGE_API_KEY
+func WithOpenCageAPIKey(key string) Option {
+	return func(s *Service) {
+		s.openCageKey = key
+	}
+}
+
+// WithUpstreamTimeout bounds each upstream request, including its retries,
+// replacing the 60s default. Zero removes the bound.
+func WithUpstreamTimeout(timeout time.Duration) Option {
+	return func(s *Service) {
+		// The client may have been supplied by the caller
+		client := *s.httpClient
+		client.Timeout = timeout
+		s.httpClient = &client
+	}
+}
+
+// WithSchoolRadius sets how far from a property, in metres, schools are
+// searched for
+func WithSchoolRadius(metres int) Option {
+	return func(s *Service) {
+		s.schoolRadius = metres
+	}
+}
+
+// WithOverpassURL overrides the Overpass endpoint used for school lookups
+func WithOverpassURL(endpoint string) Option {
+	return func(s *Service) {
+		s.overpassURL = endpoint
+	}
+}
+
+// WithTimeouts sets the per-stage deadlines applied to each lookup
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(s *Service) {
+		s.timeouts = timeouts
+	}
+}
+
+// WithCache configures the in-memory lookup cache. A zero CacheConfig disables
+// caching entirely.
+func WithCache(cfg CacheConfig) Option {
+	return func(s *Service) {
+		s.cacheConfig = cfg
+	}
+}
+
+// WithStore persists geocodes and school lookups beneath the in-memory cache,
+// using the cache TTLs. The caller remains responsible for closing the store.
+func WithStore(store Store) Option {
+	return func(s *Service) {
+		s.store = store
+	}
+}
+
+// WithRateLimit sets the token bucket for requests to host, replacing any
+// default for it. A zero Rate removes the limit.
+func WithRateLimit(host string, limit RateLimit) Option {
+	return func(s *Service) {
+		s.rateLimits[host] = limit
+	}
+}
+
+// WithStateFrom carries the in-memory cache, circuit breakers and rate
+// limiters of previous over to the new service, which replaces it with new
+// settings. Requests from both count towards the same limit for each host
+// they share, under the new service's limits. Breakers are only kept for
+// providers whose endpoint is unchanged, so that switching to another
+// instance of a failing provider takes effect straight away.
+func WithStateFrom(previous *Service) Option {
+	return func(s *Service) {
+		s.previous = previous
+	}
+}
+
+// WithRetryPolicy sets how idempotent upstream requests are retried
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(s *Service) {
+		s.retryPolicy = policy
+	}
+}
+
+// WithBreaker sets the circuit breaker configuration used for every provider
+func WithBreaker(cfg BreakerConfig) Option {
+	return func(s *Service) {
+		s.breakerCfg = cfg
+	}
+}
+
+// WithLogger sets the logger for diagnostics, stage timings and upstream
+// retries. A nil logger is ignored.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Service) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// WithTracer records spans for each lookup, its stages and every upstream
+// request, and propagates them upstream with traceparent headers
+func WithTracer(tracer *tracing.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = tracer
+	}
+}
@@ -0,0 +1,91 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ErrMissingAPIKey is returned by CheckConfig when a provider that needs a
+// key has none
+var ErrMissingAPIKey = errors.New("API key not configured")
+
+// CheckConfig reports configuration that would make every lookup of some
+// section fail, such as a missing OpenCage key
+func (s *Service) CheckConfig() error {
+	if s.openCage.APIKey == "" {
+		return fmt.Errorf("%s: %w", ProviderOpenCage, ErrMissingAPIKey)
+	}
+	return nil
+}
+
+// upstreamEndpoints returns the endpoint of each provider the service calls.
+// A custom geocoder's endpoint is unknown and left out.
+func (s *Service) upstreamEndpoints() map[string]string {
+	endpoints := map[string]string{
+		ProviderOpenCage: s.openCage.BaseURL,
+		ProviderOverpass: s.overpassURL,
+	}
+	if g, ok := s.geocoder.(*NominatimGeocoder); ok {
+		endpoints[ProviderNominatim] = g.BaseURL
+	}
+	return endpoints
+}
+
+// ProbeUpstreams checks in parallel that each upstream provider answers HTTP
+// requests, returning nil for the reachable ones. Any response below 500
+// counts, since the probe carries no query or API key. Probes wait for the
+// per-host rate limiters but skip retries and circuit breakers; a probe
+// rejected by a local limit is not evidence against the provider and counts
+// as reachable.
+func (s *Service) ProbeUpstreams(ctx context.Context) map[string]error {
+	ctx, span := s.tracer.Start(ctx, "property.ProbeUpstreams")
+	defer span.End()
+
+	endpoints := s.upstreamEndpoints()
+	client := &http.Client{Transport: s.limiter}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]error, len(endpoints))
+	)
+	for provider, endpoint := range endpoints {
+		wg.Add(1)
+		go func(provider, endpoint string) {
+			defer wg.Done()
+			err := probe(ctx, client, provider, endpoint)
+			mu.Lock()
+			results[provider] = err
+			mu.Unlock()
+		}(provider, endpoint)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func probe(ctx context.Context, client *http.Client, provider, endpoint string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrRateLimited) {
+			return nil
+		}
+		return transportError(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return newUpstreamError(provider, resp.StatusCode, resp.Header, "")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	if err := NewService(WithOpenCageAPIKey("test-key")).CheckConfig(); err != nil {
+		t.Errorf("CheckConfig() with a key = %v, want nil", err)
+	}
+	if err := NewService(WithOpenCageAPIKey("")).CheckConfig(); !errors.Is(err, ErrMissingAPIKey) {
+		t.Errorf("CheckConfig() without a key = %v, want ErrMissingAPIKey", err)
+	}
+}
+
+func TestProbeUpstreams(t *testing.T) {
+	var methods []string
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		// A bare request is rejected, but the provider is clearly up
+		http.Error(w, "missing query", http.StatusBadRequest)
+	}))
+	defer up.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	geocoder := NewNominatimGeocoder(nil)
+	geocoder.BaseURL = up.URL
+	service := NewService(
+		WithGeocoder(geocoder),
+		WithOpenCageURL(failing.URL),
+		WithOverpassURL(down.URL),
+	)
+
+	results := service.ProbeUpstreams(context.Background())
+	if len(results) != 3 {
+		t.Fatalf("ProbeUpstreams() = %v, want 3 providers", results)
+	}
+	if err := results[ProviderNominatim]; err != nil {
+		t.Errorf("nominatim probe = %v, want reachable", err)
+	}
+	var upstreamErr *UpstreamError
+	if err := results[ProviderOpenCage]; !errors.As(err, &upstreamErr) || upstreamErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("opencage probe = %v, want 503 UpstreamError", err)
+	}
+	if err := results[ProviderOverpass]; !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("overpass probe = %v, want ErrUpstreamUnavailable", err)
+	}
+	if len(methods) != 1 || methods[0] != http.MethodHead {
+		t.Errorf("probe requests = %v, want a single HEAD", methods)
+	}
+}
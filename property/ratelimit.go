@@ -0,0 +1,201 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited matches every *RateLimitError
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimit configures the token bucket for one upstream host
+type RateLimit struct {
+	// Rate is the sustained number of requests per second
+	Rate float64
+	// Burst is how many requests may be sent back to back
+	Burst int
+	// FailFast rejects a request as soon as no token is available instead
+	// of queueing it
+	FailFast bool
+}
+
+// DefaultRateLimits throttles the public upstream instances according to
+// their usage policies. Nominatim allows at most one request per second.
+var DefaultRateLimits = map[string]RateLimit{
+	"nominatim.openstreetmap.org": {Rate: 1, Burst: 1},
+	"api.opencagedata.com":        {Rate: 1, Burst: 1},
+	"overpass-api.de":             {Rate: 1, Burst: 2},
+}
+
+// RateLimitError is returned when a request to Host could not be sent within
+// its rate limit, either because the limit fails fast or because waiting for
+// a token would overrun the request deadline
+type RateLimitError struct {
+	Host string
+	Wait time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit for %s exceeded, next request allowed in %s", e.Host, e.Wait.Round(time.Millisecond))
+}
+
+// Is makes errors.Is(err, ErrRateLimited) match
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RateLimitStats reports how often requests to one host were held back
+type RateLimitStats struct {
+	Waits    uint64        `json:"waits"`
+	WaitTime time.Duration `json:"wait_time_ns"`
+	Rejected uint64        `json:"rejected"`
+}
+
+// tokenBucket is a token bucket rate limiter. Callers that have to wait
+// reserve a token up front, so concurrent waiters are queued in order.
+type tokenBucket struct {
+	mu      sync.Mutex
+	host    string
+	limit   RateLimit
+	tokens  float64
+	last    time.Time
+	stats   RateLimitStats
+	nowFunc func() time.Time
+}
+
+func newTokenBucket(host string, limit RateLimit) *tokenBucket {
+	burst := limit.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	limit.Burst = burst
+
+	return &tokenBucket{
+		host:    host,
+		limit:   limit,
+		tokens:  float64(burst),
+		last:    time.Now(),
+		nowFunc: time.Now,
+	}
+}
+
+// wait blocks until a request may be sent or ctx is done
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := b.nowFunc()
+	b.tokens = min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.mu.Unlock()
+		return nil
+	}
+
+	delay := time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+	deadline, hasDeadline := ctx.Deadline()
+	if b.limit.FailFast || (hasDeadline && now.Add(delay).After(deadline)) {
+		b.stats.Rejected++
+		b.mu.Unlock()
+		return &RateLimitError{Host: b.host, Wait: delay}
+	}
+
+	b.tokens--
+	b.stats.Waits++
+	b.stats.WaitTime += delay
+	b.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Hand the reserved token back to the callers queued behind us
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// setLimit changes the bucket's limit, keeping the tokens it holds up to the
+// new burst
+func (b *tokenBucket) setLimit(limit RateLimit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.nowFunc()
+	b.tokens = min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+	b.limit = limit
+	b.limit.Burst = max(limit.Burst, 1)
+	b.tokens = min(b.tokens, float64(b.limit.Burst))
+}
+
+func (b *tokenBucket) snapshot() RateLimitStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.stats
+}
+
+// rateLimitedTransport holds each request until the token bucket for its
+// host allows it. Hosts without a bucket are not limited.
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimitedTransport(base http.RoundTripper, limits map[string]RateLimit) *rateLimitedTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	buckets := make(map[string]*tokenBucket, len(limits))
+	for host, limit := range limits {
+		if limit.Rate > 0 {
+			buckets[host] = newTokenBucket(host, limit)
+		}
+	}
+
+	return &rateLimitedTransport{base: base, buckets: buckets}
+}
+
+// adopt takes over the buckets of other for the hosts both limit, setting
+// them to this transport's limits. It must be called before the transport
+// is used; other keeps its buckets, so requests through either share them.
+func (t *rateLimitedTransport) adopt(other *rateLimitedTransport) {
+	for host, bucket := range t.buckets {
+		if shared, ok := other.buckets[host]; ok {
+			shared.setLimit(bucket.limit)
+			t.buckets[host] = shared
+		}
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if bucket, ok := t.buckets[req.URL.Host]; ok {
+		if err := bucket.wait(req.Context()); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+func (t *rateLimitedTransport) stats() map[string]RateLimitStats {
+	stats := make(map[string]RateLimitStats, len(t.buckets))
+	for host, bucket := range t.buckets {
+		stats[host] = bucket.snapshot()
+	}
+	return stats
+}
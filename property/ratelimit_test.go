@@ -0,0 +1,117 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	t.Run("queues beyond burst", func(t *testing.T) {
+		bucket := newTokenBucket("example.com", RateLimit{Rate: 20, Burst: 2})
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if err := bucket.wait(context.Background()); err != nil {
+				t.Fatalf("wait() error = %v", err)
+			}
+		}
+
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Errorf("three requests took %v, want the third held back ~50ms", elapsed)
+		}
+		if stats := bucket.snapshot(); stats.Waits != 1 || stats.Rejected != 0 {
+			t.Errorf("snapshot() = %+v, want 1 wait", stats)
+		}
+	})
+
+	t.Run("fails fast", func(t *testing.T) {
+		bucket := newTokenBucket("example.com", RateLimit{Rate: 1, Burst: 1, FailFast: true})
+		bucket.wait(context.Background())
+
+		err := bucket.wait(context.Background())
+		var rateErr *RateLimitError
+		if !errors.As(err, &rateErr) || rateErr.Host != "example.com" {
+			t.Fatalf("wait() error = %v, want *RateLimitError", err)
+		}
+		if !errors.Is(err, ErrRateLimited) {
+			t.Errorf("wait() error = %v, want ErrRateLimited", err)
+		}
+	})
+
+	t.Run("rejects waits past the deadline", func(t *testing.T) {
+		bucket := newTokenBucket("example.com", RateLimit{Rate: 1, Burst: 1})
+		bucket.wait(context.Background())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if err := bucket.wait(ctx); !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("wait() error = %v, want ErrRateLimited", err)
+		}
+		if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+			t.Errorf("wait() took %v, want an immediate rejection", elapsed)
+		}
+	})
+
+	t.Run("cancelled waiter returns its token", func(t *testing.T) {
+		bucket := newTokenBucket("example.com", RateLimit{Rate: 10, Burst: 1})
+		bucket.wait(context.Background())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := bucket.wait(ctx); !errors.Is(err, context.Canceled) {
+			t.Fatalf("wait() error = %v, want context.Canceled", err)
+		}
+
+		start := time.Now()
+		bucket.wait(context.Background())
+		if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+			t.Errorf("wait() after cancellation took %v, want ~100ms", elapsed)
+		}
+	})
+}
+
+func TestGetInfoRateLimited(t *testing.T) {
+	details := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200}}`))
+	}))
+	defer details.Close()
+
+	schools := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"elements": []}`))
+	}))
+	defer schools.Close()
+
+	detailsURL, _ := url.Parse(details.URL)
+	service := NewService(
+		WithGeocoder(&stubGeocoder{coords: &Coordinates{Lat: 37.7749, Lon: -122.4194}}),
+		WithOpenCageURL(details.URL),
+		WithOverpassURL(schools.URL),
+		WithRateLimit(detailsURL.Host, RateLimit{Rate: 0.1, Burst: 1, FailFast: true}),
+	)
+
+	if info, err := service.GetInfo("123 Main St, San Francisco, CA 94105"); err != nil || !info.Complete() {
+		t.Fatalf("first GetInfo() = %+v, %v, want complete result", info, err)
+	}
+
+	info, err := service.GetInfo("456 Oak Ave, San Francisco, CA 94105")
+	if err != nil {
+		t.Fatalf("second GetInfo() error = %v", err)
+	}
+	if len(info.Errors) != 1 || info.Errors[0].Section != SectionDetails {
+		t.Fatalf("second GetInfo().Errors = %+v, want details only", info.Errors)
+	}
+	if !errors.Is(info.Errors[0].Err, ErrRateLimited) {
+		t.Errorf("details error = %v, want ErrRateLimited", info.Errors[0].Err)
+	}
+
+	if stats := service.Stats().RateLimits[detailsURL.Host]; stats.Rejected != 1 {
+		t.Errorf("Stats().RateLimits[%s] = %+v, want 1 rejection", detailsURL.Host, stats)
+	}
+}
@@ -0,0 +1,187 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how idempotent upstream requests are retried after
+// connection failures and 429, 502, 503 or 504 responses
+type RetryPolicy struct {
+	// MaxAttempts includes the first request; one or less disables retries
+	MaxAttempts int
+	// BaseDelay is the backoff ceiling before the first retry, doubling on
+	// each further attempt up to MaxDelay. The actual delay is jittered.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used by NewService
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// retryTransport retries idempotent requests with jittered exponential
+// backoff, honouring Retry-After. It never sleeps past the request deadline.
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+	jitter func(time.Duration) time.Duration
+	logger *slog.Logger
+}
+
+func newRetryTransport(base http.RoundTripper, policy RetryPolicy, logger *slog.Logger) *retryTransport {
+	return &retryTransport{
+		base:   base,
+		policy: policy,
+		logger: logger,
+		jitter: func(d time.Duration) time.Duration {
+			return time.Duration(rand.Int63n(int64(d) + 1))
+		},
+	}
+}
+
+// markIdempotent flags a non-GET request as safe to retry. A nil header value
+// is honoured by net/http without being sent on the wire.
+func markIdempotent(req *http.Request) {
+	req.Header["Idempotency-Key"] = nil
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	return ok
+}
+
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.policy.MaxAttempts <= 1 || !isIdempotent(req) || (req.Body != nil && req.GetBody == nil) {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	// The query string is left out since it may carry an API key
+	logger := contextLogger(ctx, t.logger).With(
+		slog.String("method", req.Method),
+		slog.String("host", req.URL.Host),
+		slog.String("path", req.URL.Path),
+	)
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+
+		var reason string
+		var retryAfter time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil || errors.Is(err, ErrRateLimited) {
+				return nil, err
+			}
+			reason = err.Error()
+		case isRetryableStatus(resp.StatusCode):
+			reason = resp.Status
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		default:
+			if attempt > 1 {
+				logger.InfoContext(ctx, "Upstream request answered after retrying",
+					slog.Int("attempt", attempt),
+					slog.Int("max_attempts", t.policy.MaxAttempts),
+					slog.Int("status", resp.StatusCode),
+				)
+			}
+			return resp, err
+		}
+
+		attemptLogger := logger.With(
+			slog.Int("attempt", attempt),
+			slog.Int("max_attempts", t.policy.MaxAttempts),
+			slog.String("reason", reason),
+		)
+		if attempt >= t.policy.MaxAttempts {
+			attemptLogger.WarnContext(ctx, "Upstream request failed; giving up")
+			return resp, err
+		}
+
+		delay := max(t.backoff(attempt), retryAfter)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			attemptLogger.WarnContext(ctx, "Upstream request failed; retry would pass the deadline", slog.Duration("delay", delay))
+			return resp, err
+		}
+
+		attemptLogger.InfoContext(ctx, "Upstream request failed; retrying", slog.Duration("delay", delay))
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns the jittered delay before the given retry
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	ceiling := t.policy.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || ceiling > t.policy.MaxDelay {
+		ceiling = t.policy.MaxDelay
+	}
+	return t.jitter(ceiling)
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as
+// an HTTP date, returning zero if it is absent or malformed
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("retry abandoned: %w", ctx.Err())
+	}
+}
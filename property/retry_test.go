@@ -0,0 +1,163 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestRetryTransport(base http.RoundTripper) *retryTransport {
+	transport := newRetryTransport(base, RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+	}, slog.Default())
+	transport.jitter = func(d time.Duration) time.Duration { return d }
+	return transport
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 12, 22, 16, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "absent", value: "", want: 0},
+		{name: "seconds", value: "3", want: 3 * time.Second},
+		{name: "http date", value: now.Add(90 * time.Second).Format(http.TimeFormat), want: 90 * time.Second},
+		{name: "date in the past", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "malformed", value: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	t.Run("retries transient statuses and resends the body", func(t *testing.T) {
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != "query" {
+				t.Errorf("attempt %d body = %q, want query", attempts.Load()+1, body)
+			}
+			if attempts.Add(1) < 3 {
+				http.Error(w, "busy", http.StatusGatewayTimeout)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("query"))
+		markIdempotent(req)
+
+		var logs strings.Builder
+		transport := newTestRetryTransport(http.DefaultTransport)
+		transport.logger = slog.New(slog.NewTextHandler(&logs, nil))
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip() error = %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || attempts.Load() != 3 {
+			t.Errorf("RoundTrip() status = %d after %d attempts, want 200 after 3", resp.StatusCode, attempts.Load())
+		}
+		// Every attempt is logged, including the one that succeeded
+		for _, want := range []string{"attempt=1", "attempt=2", `msg="Upstream request answered after retrying" method=POST`} {
+			if !strings.Contains(logs.String(), want) {
+				t.Errorf("logs = %s, want %s", logs.String(), want)
+			}
+		}
+		if !strings.Contains(logs.String(), "attempt=3 max_attempts=3 status=200") {
+			t.Errorf("logs = %s, want the successful third attempt", logs.String())
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		var attempts atomic.Int32
+		base := RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			attempts.Add(1)
+			return nil, errors.New("connection reset by peer")
+		})
+
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/search", nil)
+		if _, err := newTestRetryTransport(base).RoundTrip(req); err == nil {
+			t.Fatal("RoundTrip() expected error")
+		}
+		if got := attempts.Load(); got != 3 {
+			t.Errorf("attempts = %d, want 3", got)
+		}
+	})
+
+	t.Run("does not retry non-idempotent requests", func(t *testing.T) {
+		var attempts atomic.Int32
+		base := RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			attempts.Add(1)
+			return nil, errors.New("connection reset by peer")
+		})
+
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com/interpreter", strings.NewReader("query"))
+		newTestRetryTransport(base).RoundTrip(req)
+		if got := attempts.Load(); got != 1 {
+			t.Errorf("attempts = %d, want 1", got)
+		}
+	})
+
+	t.Run("does not retry rate limit rejections", func(t *testing.T) {
+		var attempts atomic.Int32
+		base := RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			attempts.Add(1)
+			return nil, &RateLimitError{Host: req.URL.Host}
+		})
+
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/search", nil)
+		newTestRetryTransport(base).RoundTrip(req)
+		if got := attempts.Load(); got != 1 {
+			t.Errorf("attempts = %d, want 1", got)
+		}
+	})
+
+	t.Run("retry-after beyond the deadline returns the response", func(t *testing.T) {
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+
+		start := time.Now()
+		resp, err := newTestRetryTransport(http.DefaultTransport).RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip() error = %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempts.Load() != 1 {
+			t.Errorf("RoundTrip() status = %d after %d attempts, want 429 after 1", resp.StatusCode, attempts.Load())
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("RoundTrip() took %v, want no wait", elapsed)
+		}
+	})
+}
@@ -1,37 +1,40 @@
 package property
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"math"
 	"net/http"
-	"net/url"
-	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/ssh-keyz/property-details/opencage"
 	"github.com/ssh-keyz/property-details/school"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
 
-// ValidateAddress checks if the provided address is valid
+// ValidateAddress checks if the provided address is valid, returning an
+// *AddressError if not
 func (s *Service) ValidateAddress(address string) error {
 	if strings.TrimSpace(address) == "" {
-		return fmt.Errorf("address cannot be empty")
+		return &AddressError{Reason: "address cannot be empty"}
 	}
 
 	parts := strings.Split(address, ",")
 	if len(parts) < 3 {
-		return fmt.Errorf("address must include street, city, and state")
+		return &AddressError{Reason: "address must include street, city, and state"}
 	}
 
 	addressRegex := regexp.MustCompile(`^\d+\s+[A-Za-z0-9\s.-]+,\s*[A-Za-z\s]+,\s*[A-Z]{2}\s*\d{5}?$`)
 	if !addressRegex.MatchString(strings.TrimSpace(address)) {
-		return fmt.Errorf("invalid address format")
+		return &AddressError{Reason: "invalid address format"}
 	}
 
 	return nil
@@ -39,106 +42,238 @@ func (s *Service) ValidateAddress(address string) error {
 
 // GetInfo retrieves comprehensive information about a property
 func (s *Service) GetInfo(address string) (*Info, error) {
-	if err := s.ValidateAddress(address); err != nil {
-		return nil, fmt.Errorf("address validation failed: %w", err)
-	}
+	return s.GetInfoContext(context.Background(), address)
+}
 
-	coords, err := s.geocodeAddress(address)
-	if err != nil {
-		return nil, fmt.Errorf("geocoding failed: %w", err)
-	}
+// GetInfoContext retrieves comprehensive information about a property,
+// abandoning all upstream requests once ctx is done. Property details are
+// fetched alongside geocoding, and the school lookup starts as soon as
+// coordinates are available.
+//
+// A section that fails is recorded in Info.Errors and the rest of the result
+// is still returned. An error is returned only if the address is invalid or
+// every section failed. While a provider's circuit breaker is open, expired
+// cache entries are served in its place and reported in Info.Warnings.
+func (s *Service) GetInfoContext(ctx context.Context, address string) (*Info, error) {
+	ctx, span := s.tracer.Start(ctx, "property.GetInfo")
+	defer span.End()
 
-	details, err := s.getPropertyDetails(address)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get property details: %w", err)
-	}
-
-	schools, err := s.getNearbySchools(coords)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get nearby schools: %w", err)
+	if err := s.ValidateAddress(address); err != nil {
+		err = fmt.Errorf("address validation failed: %w", err)
+		span.RecordError(err)
+		return nil, err
 	}
 
-	return &Info{
-		Address:     address,
-		Coordinates: *coords,
-		Details:     *details,
-		Schools:     schools,
-	}, nil
-}
-
-func (s *Service) geocodeAddress(address string) (*Coordinates, error) {
-	endpoint := fmt.Sprintf(
-		"https://nominatim.openstreetmap.org/search?q=%s&format=json&limit=1",
-		url.QueryEscape(address),
+	var (
+		wg                                       sync.WaitGroup
+		key                                      = normalizeAddress(address)
+		coords                                   *Coordinates
+		details                                  *Details
+		schools                                  []School
+		geocodeErr, detailsErr, schoolsErr       error
+		geocodeWarn, detailsWarn, schoolsWarn    error
+		geocodeStage, detailsStage, schoolsStage StageInfo
 	)
 
-	req, err := http.NewRequest("GET", endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("User-Agent", "PropertyInfoService/1.0")
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		start := time.Now()
+		details, detailsErr = s.getPropertyDetails(ctx, address, &detailsStage)
+		detailsStage.Duration = time.Since(start)
+		s.logStage(ctx, SectionDetails, start, detailsErr)
+		if stale, ok := s.cache.details.staleFallback(key, detailsErr); ok {
+			details, detailsWarn, detailsErr = &stale, detailsErr, nil
+			detailsStage.Cache = CacheStale
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		start := time.Now()
+		coords, geocodeErr = s.geocodeAddress(ctx, address, &geocodeStage)
+		geocodeStage.Duration = time.Since(start)
+		s.logStage(ctx, SectionGeocode, start, geocodeErr)
+		if stale, ok := s.cache.geocodes.staleFallback(key, geocodeErr); ok {
+			coords, geocodeWarn, geocodeErr = &stale, geocodeErr, nil
+			geocodeStage.Cache = CacheStale
+		}
+		if geocodeErr != nil {
+			schoolsErr = errSkipped
+			return
+		}
 
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		start = time.Now()
+		schools, schoolsErr = s.getNearbySchools(ctx, coords, &schoolsStage)
+		schoolsStage.Duration = time.Since(start)
+		s.logStage(ctx, SectionSchools, start, schoolsErr)
+		if stale, ok := s.cache.schools.staleFallback(coordinatesKey(coords), schoolsErr); ok {
+			schools, schoolsWarn, schoolsErr = slices.Clone(stale), schoolsErr, nil
+			schoolsStage.Cache = CacheStale
+		}
+	}()
+	wg.Wait()
 
-	var results []struct {
-		Lat string `json:"lat"`
-		Lon string `json:"lon"`
+	// Clients rely on schools being a list, empty when none could be found
+	if schools == nil {
+		schools = []School{}
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+	info := &Info{
+		Address:     address,
+		Coordinates: coords,
+		Details:     details,
+		Schools:     schools,
+		Stages: map[Section]StageInfo{
+			SectionGeocode: geocodeStage,
+			SectionDetails: detailsStage,
+		},
+	}
+	if !errors.Is(schoolsErr, errSkipped) {
+		info.Stages[SectionSchools] = schoolsStage
+	}
+	info.addError(SectionGeocode, geocodeErr)
+	info.addError(SectionDetails, detailsErr)
+	info.addError(SectionSchools, schoolsErr)
+	info.addWarning(SectionGeocode, geocodeWarn)
+	info.addWarning(SectionDetails, detailsWarn)
+	info.addWarning(SectionSchools, schoolsWarn)
+
+	span.SetAttribute("property.failed_sections", len(info.Errors))
+	span.SetAttribute("property.stale_sections", len(info.Warnings))
+
+	if len(info.Errors) == len(allSections) {
+		errs := make([]error, len(info.Errors))
+		for i := range info.Errors {
+			errs[i] = &info.Errors[i]
+		}
+		err := errors.Join(errs...)
+		span.RecordError(err)
 		return nil, err
 	}
 
-	if len(results) == 0 {
-		return nil, fmt.Errorf("address not found")
-	}
+	return info, nil
+}
 
-	lat, err := strconv.ParseFloat(results[0].Lat, 64)
-	if err != nil {
-		return nil, fmt.Errorf("invalid latitude value: %w", err)
+// withStageTimeout bounds a single lookup stage; a zero timeout leaves ctx as is
+func withStageTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// geocodeAddress resolves an address through the cache, joining any identical
+// lookup already in flight before asking the geocoder. How the lookup was
+// answered is recorded in stage, which may be nil.
+func (s *Service) geocodeAddress(ctx context.Context, address string, stage *StageInfo) (*Coordinates, error) {
+	ctx, span := s.tracer.Start(ctx, "property.geocode")
+	defer span.End()
+
+	if stage == nil {
+		stage = &StageInfo{}
+	}
+	stage.Provider = s.geocoder.Name()
+	span.SetAttribute("provider", stage.Provider)
+
+	key := normalizeAddress(address)
+	start := time.Now()
+	coords, ok := s.cache.geocodes.get(key)
+	stage.CacheTime = time.Since(start)
+	if ok {
+		stage.Cache = CacheHit
+		span.SetAttribute("cache", string(stage.Cache))
+		return &coords, nil
+	}
+
+	start = time.Now()
+	coords, shared, err := s.flights.geocodes.do(ctx, key, func(ctx context.Context) (Coordinates, error) {
+		ctx, cancel := withStageTimeout(ctx, s.timeouts.Geocode)
+		defer cancel()
+
+		var coords *Coordinates
+		err := s.callUpstream(s.geocoder.Name(), func() (err error) {
+			coords, err = s.geocoder.Geocode(ctx, address)
+			return err
+		})
+		if err != nil {
+			return Coordinates{}, fmt.Errorf("%s: %w", s.geocoder.Name(), err)
+		}
 
-	lon, err := strconv.ParseFloat(results[0].Lon, 64)
+		if err := s.cache.geocodes.set(key, *coords); err != nil {
+			contextLogger(ctx, s.logger).WarnContext(ctx, "Failed to cache lookup", slog.String("error", err.Error()))
+		}
+		return *coords, nil
+	})
+	stage.recordUpstream(start, shared)
+	span.SetAttribute("cache", string(stage.Cache))
 	if err != nil {
-		return nil, fmt.Errorf("invalid longitude value: %w", err)
+		span.RecordError(err)
+		return nil, err
 	}
-
-	return &Coordinates{
-		Lat: lat,
-		Lon: lon,
-	}, nil
+	return &coords, nil
 }
 
-func (s *Service) getPropertyDetails(address string) (*Details, error) {
-	endpoint := fmt.Sprintf(
-		"https://api.opencagedata.com/geocode/v1/json?q=%s&key=%s",
-		url.QueryEscape(address), os.Getenv("OPENCAGE_API_KEY"),
-	)
+// getPropertyDetails looks up details through the cache, joining any
+// identical lookup already in flight. How the lookup was answered is
+// recorded in stage, which may be nil.
+func (s *Service) getPropertyDetails(ctx context.Context, address string, stage *StageInfo) (*Details, error) {
+	ctx, span := s.tracer.Start(ctx, "property.details")
+	defer span.End()
+
+	if stage == nil {
+		stage = &StageInfo{}
+	}
+	stage.Provider = ProviderOpenCage
+	span.SetAttribute("provider", stage.Provider)
+
+	key := normalizeAddress(address)
+	start := time.Now()
+	details, ok := s.cache.details.get(key)
+	stage.CacheTime = time.Since(start)
+	if ok {
+		stage.Cache = CacheHit
+		span.SetAttribute("cache", string(stage.Cache))
+		return &details, nil
+	}
+
+	start = time.Now()
+	details, shared, err := s.flights.details.do(ctx, key, func(ctx context.Context) (Details, error) {
+		ctx, cancel := withStageTimeout(ctx, s.timeouts.Details)
+		defer cancel()
+
+		var details *Details
+		err := s.callUpstream(ProviderOpenCage, func() (err error) {
+			details, err = s.fetchPropertyDetails(ctx, address)
+			return err
+		})
+		if err != nil {
+			return Details{}, err
+		}
 
-	req, err := http.NewRequest("GET", endpoint, nil)
+		if err := s.cache.details.set(key, *details); err != nil {
+			contextLogger(ctx, s.logger).WarnContext(ctx, "Failed to cache lookup", slog.String("error", err.Error()))
+		}
+		return *details, nil
+	})
+	stage.recordUpstream(start, shared)
+	span.SetAttribute("cache", string(stage.Cache))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		span.RecordError(err)
+		return nil, err
 	}
+	return &details, nil
+}
 
-	resp, err := s.httpClient.Do(req)
+func (s *Service) fetchPropertyDetails(ctx context.Context, address string) (*Details, error) {
+	result, err := s.openCage.Geocode(ctx, address)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch property details: %w", err)
+		return nil, fmt.Errorf("failed to fetch property details: %w", openCageError(err))
 	}
-	defer resp.Body.Close()
 
-	var rawResponse map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&rawResponse); err != nil {
-		return nil, fmt.Errorf("failed to decode raw response: %w", err)
-	}
-
-	var result opencage.Response
-	rawJSON, _ := json.Marshal(rawResponse)
-	if err := json.Unmarshal(rawJSON, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse structured response: %w", err)
+	// OpenCage matching nothing means the address does not exist, not that
+	// its details are unknown
+	if len(result.Results) == 0 {
+		return nil, fmt.Errorf("failed to fetch property details: %w", ErrAddressNotFound)
 	}
 
 	details := &Details{
@@ -148,73 +283,133 @@ func (s *Service) getPropertyDetails(address string) (*Details, error) {
 		LastUpdated: time.Now().Format(time.RFC3339),
 	}
 
-	if len(result.Results) > 0 {
-		components := result.Results[0].Components
-		annotations := result.Results[0].Annotations
+	components := result.Results[0].Components
+	annotations := result.Results[0].Annotations
 
-		sizeDetails := []string{}
+	sizeDetails := []string{}
 
-		if components.Type == "residential" || components.Category == "building" {
-			if components.BuildingUse != "" {
-				sizeDetails = append(sizeDetails, components.BuildingUse)
-			}
-			if components.Type != "" {
-				sizeDetails = append(sizeDetails, components.Type)
-			}
+	if components.Type == "residential" || components.Category == "building" {
+		if components.BuildingUse != "" {
+			sizeDetails = append(sizeDetails, components.BuildingUse)
 		}
-
-		if components.BuildingLevels != "" {
-			sizeDetails = append(sizeDetails, fmt.Sprintf("%s stories", components.BuildingLevels))
-		} else if annotations.OSM.BuildingLevels != "" {
-			sizeDetails = append(sizeDetails, fmt.Sprintf("%s stories", annotations.OSM.BuildingLevels))
+		if components.Type != "" {
+			sizeDetails = append(sizeDetails, components.Type)
 		}
+	}
 
-		if components.Apartments != "" {
-			sizeDetails = append(sizeDetails, "apartment building")
-		}
+	if components.BuildingLevels != "" {
+		sizeDetails = append(sizeDetails, fmt.Sprintf("%s stories", components.BuildingLevels))
+	} else if annotations.OSM.BuildingLevels != "" {
+		sizeDetails = append(sizeDetails, fmt.Sprintf("%s stories", annotations.OSM.BuildingLevels))
+	}
 
-		if len(sizeDetails) > 0 {
-			details.Size = strings.Join(sizeDetails, " ")
-		} else {
-			details.Size = "Residential Property"
-		}
+	if components.Apartments != "" {
+		sizeDetails = append(sizeDetails, "apartment building")
+	}
 
-		if levels, err := strconv.Atoi(components.BuildingLevels); err == nil && levels > 0 {
-			details.Rooms = levels * 2
-		}
+	if len(sizeDetails) > 0 {
+		details.Size = strings.Join(sizeDetails, " ")
+	} else {
+		details.Size = "Residential Property"
+	}
 
-		if annotations.OSM.BuildingType != "" {
-			fmt.Printf("  OSM Building Type: %s\n", annotations.OSM.BuildingType)
-		}
-		if annotations.OSM.BuildingLevels != "" {
-			fmt.Printf("  OSM Building Levels: %s\n", annotations.OSM.BuildingLevels)
-		}
+	if levels, err := strconv.Atoi(components.BuildingLevels); err == nil && levels > 0 {
+		details.Rooms = levels * 2
 	}
 
+	contextLogger(ctx, s.logger).DebugContext(ctx, "OpenCage building annotations",
+		slog.String("osm_building_type", annotations.OSM.BuildingType),
+		slog.String("osm_building_levels", annotations.OSM.BuildingLevels),
+	)
+
 	return details, nil
 }
 
-func (s *Service) getNearbySchools(coords *Coordinates) ([]School, error) {
+// getNearbySchools looks up schools through the cache, joining any identical
+// lookup already in flight. How the lookup was answered is recorded in
+// stage, which may be nil.
+func (s *Service) getNearbySchools(ctx context.Context, coords *Coordinates, stage *StageInfo) ([]School, error) {
+	ctx, span := s.tracer.Start(ctx, "property.schools")
+	defer span.End()
+
+	if stage == nil {
+		stage = &StageInfo{}
+	}
+	stage.Provider = ProviderOverpass
+	span.SetAttribute("provider", stage.Provider)
+
+	key := coordinatesKey(coords)
+	start := time.Now()
+	schools, ok := s.cache.schools.get(key)
+	stage.CacheTime = time.Since(start)
+	if ok {
+		stage.Cache = CacheHit
+		span.SetAttribute("cache", string(stage.Cache))
+		span.SetAttribute("schools.count", len(schools))
+		return slices.Clone(schools), nil
+	}
+
+	start = time.Now()
+	schools, shared, err := s.flights.schools.do(ctx, key, func(ctx context.Context) ([]School, error) {
+		ctx, cancel := withStageTimeout(ctx, s.timeouts.Schools)
+		defer cancel()
+
+		var schools []School
+		err := s.callUpstream(ProviderOverpass, func() (err error) {
+			schools, err = s.fetchNearbySchools(ctx, coords)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.cache.schools.set(key, slices.Clone(schools)); err != nil {
+			contextLogger(ctx, s.logger).WarnContext(ctx, "Failed to cache lookup", slog.String("error", err.Error()))
+		}
+		return schools, nil
+	})
+	stage.recordUpstream(start, shared)
+	span.SetAttribute("cache", string(stage.Cache))
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttribute("schools.count", len(schools))
+	return slices.Clone(schools), nil
+}
+
+func (s *Service) fetchNearbySchools(ctx context.Context, coords *Coordinates) ([]School, error) {
 	query := fmt.Sprintf(
 		`[out:json][timeout:25];
         (
-            way["amenity"="school"]["name"](around:2000,%f,%f);
-            relation["amenity"="school"]["name"](around:2000,%f,%f);
-            node["amenity"="school"]["name"](around:2000,%f,%f);
+            way["amenity"="school"]["name"](around:%d,%f,%f);
+            relation["amenity"="school"]["name"](around:%d,%f,%f);
+            node["amenity"="school"]["name"](around:%d,%f,%f);
         );
         out center;`,
-		coords.Lat, coords.Lon,
-		coords.Lat, coords.Lon,
-		coords.Lat, coords.Lon,
+		s.schoolRadius, coords.Lat, coords.Lon,
+		s.schoolRadius, coords.Lat, coords.Lon,
+		s.schoolRadius, coords.Lat, coords.Lon,
 	)
 
-	endpoint := "https://overpass-api.de/api/interpreter"
-	resp, err := s.httpClient.Post(endpoint, "text/plain", strings.NewReader(query))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.overpassURL, strings.NewReader(query))
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch schools: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	// The query only reads data, so it is safe to retry despite being a POST
+	markIdempotent(req)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schools: %w", transportError(err))
 	}
 	defer resp.Body.Close()
 
+	if err := checkStatus(ProviderOverpass, resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch schools: %w", err)
+	}
+
 	var rawResponse map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&rawResponse); err != nil {
 		return nil, fmt.Errorf("failed to decode raw response: %w", err)
@@ -238,6 +433,7 @@ func (s *Service) getNearbySchools(coords *Coordinates) ([]School, error) {
 		return nil, fmt.Errorf("failed to parse structured response: %w", err)
 	}
 
+	logger := contextLogger(ctx, s.logger)
 	schools := make([]School, 0)
 	for _, element := range result.Elements {
 		if element.Tags.Name == "" {
@@ -252,13 +448,16 @@ func (s *Service) getNearbySchools(coords *Coordinates) ([]School, error) {
 			schoolLat = element.Center.Lat
 			schoolLon = element.Center.Lon
 		} else {
-			fmt.Printf("Skipping school %s: no valid coordinates\n", element.Tags.Name)
+			logger.DebugContext(ctx, "Skipping school without coordinates", slog.String("school", element.Tags.Name))
 			continue
 		}
 
 		if !AreValidCoordinates(schoolLat, schoolLon) {
-			fmt.Printf("Skipping school %s: invalid coordinates (%f,%f)\n",
-				element.Tags.Name, schoolLat, schoolLon)
+			logger.DebugContext(ctx, "Skipping school with invalid coordinates",
+				slog.String("school", element.Tags.Name),
+				slog.Float64("lat", schoolLat),
+				slog.Float64("lon", schoolLon),
+			)
 			continue
 		}
 
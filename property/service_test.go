@@ -2,14 +2,19 @@
 package property
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
-	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ssh-keyz/property-details/school"
 )
@@ -51,6 +56,9 @@ func TestValidateAddress(t *testing.T) {
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateAddress() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if tt.wantErr && !errors.Is(err, ErrInvalidAddress) {
+				t.Errorf("ValidateAddress() error = %v, want ErrInvalidAddress", err)
+			}
 		})
 	}
 }
@@ -223,6 +231,11 @@ func TestMockSchoolRating(t *testing.T) {
 }
 
 func TestGetInfo(t *testing.T) {
+	// OpenCage knows the address even where the geocoder fails
+	detailsFound := map[string]interface{}{
+		"results": []map[string]interface{}{{"components": map[string]interface{}{}}},
+	}
+
 	tests := []struct {
 		name          string
 		geocodeResp   interface{}
@@ -237,6 +250,7 @@ func TestGetInfo(t *testing.T) {
 		emptyResults  bool
 		invalidLatLon bool
 		skipTest      bool
+		wantErrors    []Section
 	}{
 		{
 			name: "successful case",
@@ -308,14 +322,16 @@ func TestGetInfo(t *testing.T) {
 		{
 			name:         "empty results",
 			emptyResults: true,
+			detailsResp:  detailsFound,
 			address:      "123 Main St, San Francisco, CA 94105",
-			wantErr:      true,
+			wantErrors:   []Section{SectionGeocode, SectionSchools},
 		},
 		{
 			name:          "invalid lat/lon",
 			invalidLatLon: true,
+			detailsResp:   detailsFound,
 			address:       "123 Main St, San Francisco, CA 94105",
-			wantErr:       true,
+			wantErrors:    []Section{SectionGeocode, SectionSchools},
 		},
 	}
 
@@ -387,13 +403,11 @@ func TestGetInfo(t *testing.T) {
 				return http.DefaultTransport.RoundTrip(req)
 			})
 
-			service := &Service{httpClient: client}
-
+			apiKey := "test-key"
 			if tt.missingAPIKey {
-				os.Unsetenv("OPENCAGE_API_KEY")
-			} else {
-				os.Setenv("OPENCAGE_API_KEY", "test-key")
+				apiKey = ""
 			}
+			service := NewService(WithHTTPClient(client), WithOpenCageAPIKey(apiKey))
 
 			info, err := service.GetInfo(tt.address)
 			if (err != nil) != tt.wantErr {
@@ -401,11 +415,30 @@ func TestGetInfo(t *testing.T) {
 				return
 			}
 
+			if err == nil && len(tt.wantErrors) > 0 {
+				if info.Complete() {
+					t.Fatal("GetInfo() result is complete, want partial")
+				}
+				if len(info.Errors) != len(tt.wantErrors) {
+					t.Fatalf("GetInfo().Errors = %+v, want sections %v", info.Errors, tt.wantErrors)
+				}
+				for i, section := range tt.wantErrors {
+					if info.Errors[i].Section != section {
+						t.Errorf("GetInfo().Errors[%d].Section = %v, want %v", i, info.Errors[i].Section, section)
+					}
+				}
+				return
+			}
+
 			if err == nil {
 				if info.Address != tt.address {
 					t.Errorf("GetInfo().Address = %v, want %v", info.Address, tt.address)
 				}
 
+				if !info.Complete() {
+					t.Errorf("GetInfo().Errors = %+v, want none", info.Errors)
+				}
+
 				if len(info.Schools) == 0 {
 					t.Error("GetInfo().Schools is empty")
 				}
@@ -484,8 +517,8 @@ func TestGeocodeAddress(t *testing.T) {
 				}),
 			}
 
-			service := &Service{httpClient: client}
-			coords, err := service.geocodeAddress(tt.address)
+			service := NewService(WithHTTPClient(client))
+			coords, err := service.geocodeAddress(context.Background(), tt.address, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("geocodeAddress() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -564,13 +597,11 @@ func TestGetPropertyDetails(t *testing.T) {
 			wantErr:    true,
 		},
 		{
-			name:       "empty response",
+			name:       "no match",
 			address:    "123 Main St",
 			response:   `{"results": []}`,
 			statusCode: http.StatusOK,
-			wantErr:    false,
-			wantSize:   "Mock-Data",
-			wantRooms:  3,
+			wantErr:    true,
 		},
 	}
 
@@ -590,11 +621,9 @@ func TestGetPropertyDetails(t *testing.T) {
 				}),
 			}
 
-			service := &Service{httpClient: client}
-			os.Setenv("OPENCAGE_API_KEY", "test-key")
-			defer os.Unsetenv("OPENCAGE_API_KEY")
+			service := NewService(WithHTTPClient(client), WithOpenCageAPIKey("test-key"))
 
-			details, err := service.getPropertyDetails(tt.address)
+			details, err := service.getPropertyDetails(context.Background(), tt.address, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("getPropertyDetails() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -742,8 +771,8 @@ func TestGetNearbySchools(t *testing.T) {
 				}),
 			}
 
-			service := &Service{httpClient: client}
-			schools, err := service.getNearbySchools(tt.coords)
+			service := NewService(WithHTTPClient(client))
+			schools, err := service.getNearbySchools(context.Background(), tt.coords, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("getNearbySchools() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -773,6 +802,318 @@ func TestGetNearbySchools(t *testing.T) {
 	}
 }
 
+func TestSchoolRadiusAndUpstreamTimeout(t *testing.T) {
+	var query string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		query = string(body)
+		if r.URL.Query().Get("slow") != "" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte(`{"elements": []}`))
+	}))
+	defer upstream.Close()
+
+	service := NewService(WithOverpassURL(upstream.URL), WithSchoolRadius(500))
+	if _, err := service.getNearbySchools(context.Background(), &Coordinates{Lat: 37.7749, Lon: -122.4194}, nil); err != nil {
+		t.Fatalf("getNearbySchools() error = %v", err)
+	}
+	if !strings.Contains(query, "around:500,") {
+		t.Errorf("Overpass query = %s, want a 500m radius", query)
+	}
+
+	service = NewService(
+		WithOverpassURL(upstream.URL+"?slow=1"),
+		WithUpstreamTimeout(50*time.Millisecond),
+		WithRetryPolicy(RetryPolicy{}),
+	)
+	if _, err := service.getNearbySchools(context.Background(), &Coordinates{Lat: 37.7749, Lon: -122.4194}, nil); err == nil {
+		t.Error("getNearbySchools() past the upstream timeout succeeded, want an error")
+	}
+}
+
+func TestGetInfoRunsStagesConcurrently(t *testing.T) {
+	detailsStarted := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/geocode":
+			close(detailsStarted)
+			w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200}}`))
+		case "/interpreter":
+			w.Write([]byte(`{"elements": []}`))
+		}
+	}))
+	defer upstream.Close()
+
+	geocoder := geocoderFunc(func(ctx context.Context, address string) (*Coordinates, error) {
+		select {
+		case <-detailsStarted:
+			return &Coordinates{Lat: 37.7749, Lon: -122.4194}, nil
+		case <-time.After(2 * time.Second):
+			return nil, errors.New("details lookup did not run alongside geocoding")
+		}
+	})
+
+	service := NewService(
+		WithGeocoder(geocoder),
+		WithOpenCageURL(upstream.URL+"/geocode"),
+		WithOverpassURL(upstream.URL+"/interpreter"),
+	)
+
+	if _, err := service.GetInfo("123 Main St, San Francisco, CA 94105"); err != nil {
+		t.Fatalf("GetInfo() error = %v", err)
+	}
+}
+
+func TestGetInfoPartialResults(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"components": {"type": "residential"}}], "status": {"code": 200}}`))
+	}))
+	defer upstream.Close()
+
+	service := NewService(
+		WithGeocoder(&stubGeocoder{err: ErrAddressNotFound}),
+		WithOpenCageURL(upstream.URL),
+		WithOverpassURL(upstream.URL),
+	)
+
+	info, err := service.GetInfo("123 Main St, San Francisco, CA 94105")
+	if err != nil {
+		t.Fatalf("GetInfo() error = %v", err)
+	}
+	if info.Details == nil || info.Details.Size != "residential" {
+		t.Errorf("GetInfo().Details = %+v, want details despite geocoding failure", info.Details)
+	}
+	if info.Coordinates != nil || info.Schools == nil || len(info.Schools) != 0 {
+		t.Errorf("GetInfo() = %+v, want no coordinates and an empty school list", info)
+	}
+	if len(info.Errors) != 2 || info.Errors[0].Section != SectionGeocode || info.Errors[1].Section != SectionSchools {
+		t.Fatalf("GetInfo().Errors = %+v, want geocode and schools", info.Errors)
+	}
+	if !errors.Is(info.Errors[1].Err, errSkipped) {
+		t.Errorf("schools error = %v, want skipped", info.Errors[1].Err)
+	}
+}
+
+func TestGetInfoAddressNotFound(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [], "status": {"code": 200}}`))
+	}))
+	defer upstream.Close()
+
+	service := NewService(
+		WithGeocoder(&stubGeocoder{err: ErrAddressNotFound}),
+		WithOpenCageURL(upstream.URL),
+		WithOverpassURL(upstream.URL),
+	)
+
+	info, err := service.GetInfo("123 Main St, San Francisco, CA 94105")
+	if !errors.Is(err, ErrAddressNotFound) {
+		t.Errorf("GetInfo() = %+v, %v, want ErrAddressNotFound", info, err)
+	}
+}
+
+func TestGetInfoUpstreamErrorStatus(t *testing.T) {
+	details := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"results": [], "status": {"code": 403, "message": "API key disabled"}}`))
+	}))
+	defer details.Close()
+
+	schools := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`<html><body><h1>502 Bad Gateway</h1></body></html>`))
+	}))
+	defer schools.Close()
+
+	service := NewService(
+		WithGeocoder(&stubGeocoder{coords: &Coordinates{Lat: 37.7749, Lon: -122.4194}}),
+		WithOpenCageURL(details.URL),
+		WithOverpassURL(schools.URL),
+		WithRetryPolicy(RetryPolicy{}),
+	)
+
+	info, err := service.GetInfo("123 Main St, San Francisco, CA 94105")
+	if err != nil {
+		t.Fatalf("GetInfo() error = %v", err)
+	}
+	if len(info.Errors) != 2 || info.Errors[0].Section != SectionDetails || info.Errors[1].Section != SectionSchools {
+		t.Fatalf("GetInfo().Errors = %+v, want details and schools", info.Errors)
+	}
+
+	var upstreamErr *UpstreamError
+	if !errors.As(info.Errors[0].Err, &upstreamErr) || !errors.Is(upstreamErr, ErrInvalidAPIKey) || upstreamErr.Message != "API key disabled" {
+		t.Errorf("details error = %v, want invalid API key from opencage", info.Errors[0].Err)
+	}
+	if !errors.As(info.Errors[1].Err, &upstreamErr) || upstreamErr.Provider != ProviderOverpass || upstreamErr.RetryAfter != 2*time.Minute {
+		t.Errorf("schools error = %v, want *UpstreamError from overpass retrying in 2m", info.Errors[1].Err)
+	}
+	if !errors.Is(info.Errors[1].Err, ErrUpstreamUnavailable) {
+		t.Errorf("schools error = %v, want ErrUpstreamUnavailable", info.Errors[1].Err)
+	}
+}
+
+func TestGetInfoOpenCageQuota(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	var remaining atomic.Int32
+	remaining.Store(1)
+	details := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		left := remaining.Add(-1)
+		w.Header().Set("X-RateLimit-Limit", "2500")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(max(left, 0))))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if left < 0 {
+			// OpenCage reports an exhausted quota in the status block
+			w.Write([]byte(`{"results": [], "status": {"code": 402, "message": "quota exceeded"}}`))
+			return
+		}
+		w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200, "message": "OK"}}`))
+	}))
+	defer details.Close()
+
+	schools := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"elements": []}`))
+	}))
+	defer schools.Close()
+
+	service := NewService(
+		WithGeocoder(&stubGeocoder{coords: &Coordinates{Lat: 37.7749, Lon: -122.4194}}),
+		WithOpenCageURL(details.URL),
+		WithOverpassURL(schools.URL),
+	)
+
+	if _, ok := service.OpenCageQuota(); ok {
+		t.Error("OpenCageQuota() reported before any lookup")
+	}
+
+	if info, err := service.GetInfo("123 Main St, San Francisco, CA 94105"); err != nil || !info.Complete() {
+		t.Fatalf("first GetInfo() = %+v, %v, want complete result", info, err)
+	}
+	if quota, ok := service.OpenCageQuota(); !ok || quota.Limit != 2500 || quota.Remaining != 0 || !quota.Reset.Equal(reset) {
+		t.Errorf("OpenCageQuota() = %+v, %v, want 0 of 2500 remaining", quota, ok)
+	}
+
+	info, err := service.GetInfo("456 Oak Ave, San Francisco, CA 94105")
+	if err != nil {
+		t.Fatalf("second GetInfo() error = %v", err)
+	}
+	if info.Details != nil || len(info.Errors) != 1 {
+		t.Fatalf("second GetInfo() = %+v, want a details error instead of mock data", info)
+	}
+
+	var upstreamErr *UpstreamError
+	if !errors.As(info.Errors[0].Err, &upstreamErr) || !errors.Is(upstreamErr, ErrQuotaExceeded) {
+		t.Fatalf("details error = %v, want ErrQuotaExceeded", info.Errors[0].Err)
+	}
+	if upstreamErr.RetryAfter <= 59*time.Minute || upstreamErr.RetryAfter > time.Hour {
+		t.Errorf("details error RetryAfter = %v, want about an hour until the quota resets", upstreamErr.RetryAfter)
+	}
+}
+
+func TestGetInfoAllSectionsFailed(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	stubErr := ErrAddressNotFound
+	service := NewService(
+		WithGeocoder(&stubGeocoder{err: stubErr}),
+		WithOpenCageURL(upstream.URL),
+		WithOverpassURL(upstream.URL),
+	)
+
+	info, err := service.GetInfo("123 Main St, San Francisco, CA 94105")
+	if err == nil {
+		t.Fatalf("GetInfo() = %+v, want error", info)
+	}
+	if !errors.Is(err, stubErr) {
+		t.Errorf("GetInfo() error = %v, want it to wrap the geocoding failure", err)
+	}
+
+	var sectionErr *SectionError
+	if !errors.As(err, &sectionErr) || sectionErr.Section != SectionGeocode {
+		t.Errorf("GetInfo() error = %v, want *SectionError for geocode", err)
+	}
+}
+
+func TestGetInfoContextCancelled(t *testing.T) {
+	requested := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	geocoder := geocoderFunc(func(ctx context.Context, address string) (*Coordinates, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	service := NewService(
+		WithGeocoder(geocoder),
+		WithOpenCageURL(upstream.URL),
+		WithOverpassURL(upstream.URL),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-requested
+		cancel()
+	}()
+
+	_, err := service.GetInfoContext(ctx, "123 Main St, San Francisco, CA 94105")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetInfoContext() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestGetInfoStageTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/geocode":
+			w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200}}`))
+		case "/interpreter":
+			io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+		}
+	}))
+	defer upstream.Close()
+
+	service := NewService(
+		WithGeocoder(&stubGeocoder{coords: &Coordinates{Lat: 37.7749, Lon: -122.4194}}),
+		WithOpenCageURL(upstream.URL+"/geocode"),
+		WithOverpassURL(upstream.URL+"/interpreter"),
+		WithTimeouts(Timeouts{Schools: 50 * time.Millisecond}),
+	)
+
+	info, err := service.GetInfo("123 Main St, San Francisco, CA 94105")
+	if err != nil {
+		t.Fatalf("GetInfo() error = %v", err)
+	}
+	if len(info.Errors) != 1 || info.Errors[0].Section != SectionSchools {
+		t.Fatalf("GetInfo().Errors = %+v, want schools only", info.Errors)
+	}
+	if !errors.Is(info.Errors[0].Err, context.DeadlineExceeded) {
+		t.Errorf("schools error = %v, want context.DeadlineExceeded", info.Errors[0].Err)
+	}
+}
+
+// geocoderFunc allows us to use a function as a Geocoder
+type geocoderFunc func(ctx context.Context, address string) (*Coordinates, error)
+
+// Name implements the Geocoder interface
+func (f geocoderFunc) Name() string {
+	return "func"
+}
+
+// Geocode implements the Geocoder interface
+func (f geocoderFunc) Geocode(ctx context.Context, address string) (*Coordinates, error) {
+	return f(ctx, address)
+}
+
 // RoundTripFunc allows us to use a function as an http.RoundTripper
 type RoundTripFunc func(*http.Request) (*http.Response, error)
 
@@ -780,3 +1121,70 @@ type RoundTripFunc func(*http.Request) (*http.Response, error)
 func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
 	return f(req)
 }
+
+func TestNewServiceWithStateFrom(t *testing.T) {
+	var down atomic.Bool
+	details := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200}}`))
+	}))
+	defer details.Close()
+
+	schools := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"elements": []}`))
+	}))
+	defer schools.Close()
+	schoolsURL, _ := url.Parse(schools.URL)
+
+	options := func(coords *Coordinates, rate float64, opts ...Option) []Option {
+		return append([]Option{
+			WithGeocoder(&stubGeocoder{coords: coords}),
+			WithOpenCageURL(details.URL),
+			WithOverpassURL(schools.URL),
+			WithRetryPolicy(RetryPolicy{}),
+			WithBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}),
+			WithRateLimit(schoolsURL.Host, RateLimit{Rate: rate, Burst: 1, FailFast: true}),
+		}, opts...)
+	}
+	previous := NewService(options(&Coordinates{Lat: 37.7749, Lon: -122.4194}, 0.001)...)
+
+	if info, err := previous.GetInfo("123 Main St, San Francisco, CA 94105"); err != nil || !info.Complete() {
+		t.Fatalf("first GetInfo() = %+v, %v, want complete result", info, err)
+	}
+	down.Store(true)
+	if _, err := previous.GetInfo("456 Oak Ave, San Francisco, CA 94105"); err != nil {
+		t.Fatalf("second GetInfo() error = %v", err)
+	}
+
+	service := NewService(options(&Coordinates{Lat: 40.7128, Lon: -74.006}, 0.002, WithStateFrom(previous))...)
+
+	if got := service.Stats().Cache[SectionGeocode].Entries; got != 2 {
+		t.Errorf("geocode cache entries = %d, want the previous service's 2", got)
+	}
+	if state := service.Breakers()[ProviderOpenCage].State; state != BreakerOpen {
+		t.Errorf("opencage breaker = %q, want the previous service's open breaker", state)
+	}
+
+	// The Overpass token spent by the previous service is not handed out again
+	info, err := service.GetInfo("1 Broadway, New York, NY 10004")
+	if err != nil {
+		t.Fatalf("GetInfo() error = %v", err)
+	}
+	var schoolsErr error
+	for _, sectionErr := range info.Errors {
+		if sectionErr.Section == SectionSchools {
+			schoolsErr = sectionErr.Err
+		}
+	}
+	if !errors.Is(schoolsErr, ErrRateLimited) {
+		t.Errorf("schools error = %v, want ErrRateLimited from the shared bucket", schoolsErr)
+	}
+
+	moved := NewService(options(&Coordinates{Lat: 40.7128, Lon: -74.006}, 0.002, WithOpenCageURL(schools.URL), WithStateFrom(previous))...)
+	if state := moved.Breakers()[ProviderOpenCage].State; state != BreakerClosed {
+		t.Errorf("opencage breaker = %q, want a fresh breaker for the new endpoint", state)
+	}
+}
@@ -0,0 +1,42 @@
+package property
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ssh-keyz/property-details/tracing"
+)
+
+// tracingTransport records a span for each upstream request attempt and
+// propagates it with a traceparent header
+type tracingTransport struct {
+	base   http.RoundTripper
+	tracer *tracing.Tracer
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), "HTTP "+req.Method)
+	defer span.End()
+
+	// The query string is left out since it may carry an API key
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("server.address", req.URL.Host)
+	span.SetAttribute("url.path", req.URL.Path)
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(ctx)
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		span.RecordError(fmt.Errorf("upstream returned %s", resp.Status))
+	}
+	return resp, nil
+}
@@ -0,0 +1,98 @@
+package property
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ssh-keyz/property-details/tracing"
+)
+
+func TestGetInfoTracing(t *testing.T) {
+	var mu sync.Mutex
+	traceparents := make(map[string]string)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents[r.Method] = r.Header.Get(tracing.TraceparentHeader)
+		mu.Unlock()
+
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"elements": [{"type": "node", "lat": 37.78, "lon": -122.41, "tags": {"name": "Example School", "amenity": "school"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200}}`))
+	}))
+	defer upstream.Close()
+
+	recorder := &tracing.Recorder{}
+	service := NewService(
+		WithGeocoder(&stubGeocoder{coords: &Coordinates{Lat: 37.7749, Lon: -122.4194}}),
+		WithOpenCageURL(upstream.URL),
+		WithOverpassURL(upstream.URL),
+		WithTracer(tracing.NewTracer(recorder)),
+	)
+
+	if _, err := service.GetInfoContext(context.Background(), "123 Main St, San Francisco, CA 94105"); err != nil {
+		t.Fatalf("GetInfoContext() error = %v", err)
+	}
+
+	spans := make(map[string]tracing.SpanData)
+	byID := make(map[string]tracing.SpanData)
+	for _, span := range recorder.Spans() {
+		key := span.Name
+		if method, ok := span.Attributes["http.method"]; ok {
+			key += " " + method.(string)
+		}
+		spans[key] = span
+		byID[span.SpanID] = span
+	}
+
+	root, ok := spans["property.GetInfo"]
+	if !ok {
+		t.Fatalf("spans = %+v, want property.GetInfo", recorder.Spans())
+	}
+
+	for _, stage := range []struct {
+		name     string
+		provider string
+	}{
+		{name: "property.geocode", provider: "stub"},
+		{name: "property.details", provider: ProviderOpenCage},
+		{name: "property.schools", provider: ProviderOverpass},
+	} {
+		span, ok := spans[stage.name]
+		if !ok {
+			t.Errorf("no %s span", stage.name)
+			continue
+		}
+		if span.TraceID != root.TraceID || span.ParentSpanID != root.SpanID {
+			t.Errorf("%s span = %+v, want a child of GetInfo", stage.name, span)
+		}
+		if span.Attributes["provider"] != stage.provider || span.Attributes["cache"] != "miss" {
+			t.Errorf("%s attributes = %v, want provider %s and a cache miss", stage.name, span.Attributes, stage.provider)
+		}
+	}
+	if count := spans["property.schools"].Attributes["schools.count"]; count != 1 {
+		t.Errorf("schools.count = %v, want 1", count)
+	}
+
+	for method, parent := range map[string]string{http.MethodGet: "property.details", http.MethodPost: "property.schools"} {
+		span, ok := spans["HTTP "+method+" "+method]
+		if !ok {
+			t.Errorf("no HTTP %s span", method)
+			continue
+		}
+		if byID[span.ParentSpanID].Name != parent || span.Attributes["http.status_code"] != http.StatusOK {
+			t.Errorf("HTTP %s span = %+v, want a successful child of %s", method, span, parent)
+		}
+
+		mu.Lock()
+		got := traceparents[method]
+		mu.Unlock()
+		if want := "00-" + span.TraceID + "-" + span.SpanID + "-01"; got != want {
+			t.Errorf("upstream %s traceparent = %q, want %q", method, got, want)
+		}
+	}
+}
@@ -2,21 +2,184 @@
 package property
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
 	"net/http"
+	"os"
 	"time"
+
+	"github.com/ssh-keyz/property-details/opencage"
+	"github.com/ssh-keyz/property-details/tracing"
+)
+
+// DefaultOverpassURL is the public Overpass API interpreter endpoint
+const DefaultOverpassURL = "https://overpass-api.de/api/interpreter"
+
+// DefaultSchoolRadius is how far from a property, in metres, schools are
+// searched for by default
+const DefaultSchoolRadius = 2000
+
+// Names of the upstream providers, as used for circuit breakers and errors
+const (
+	ProviderNominatim = "nominatim"
+	ProviderOpenCage  = "opencage"
+	ProviderOverpass  = "overpass"
 )
 
 // Service handles property-related operations
 type Service struct {
-	httpClient *http.Client
+	httpClient   *http.Client
+	geocoder     Geocoder
+	openCage     *opencage.Client
+	openCageURL  string
+	openCageKey  string
+	overpassURL  string
+	schoolRadius int
+	timeouts     Timeouts
+	cacheConfig  CacheConfig
+	store        Store
+	cache        *lookupCache
+	flights      lookupFlights
+	rateLimits   map[string]RateLimit
+	limiter      *rateLimitedTransport
+	retryPolicy  RetryPolicy
+	breakerCfg   BreakerConfig
+	breakers     *breakerSet
+	upstreams    upstreamStats
+	logger       *slog.Logger
+	tracer       *tracing.Tracer
+	// previous is the service whose state is carried over, only set while
+	// the service is being built
+	previous *Service
+}
+
+// Timeouts bounds each stage of a lookup. A zero value disables the
+// per-stage deadline, leaving only the caller's context and client timeout.
+type Timeouts struct {
+	Geocode time.Duration
+	Details time.Duration
+	Schools time.Duration
+}
+
+// DefaultTimeouts are the per-stage deadlines used by NewService. Schools get
+// the longest budget because the Overpass query itself may run for 25s.
+var DefaultTimeouts = Timeouts{
+	Geocode: 10 * time.Second,
+	Details: 10 * time.Second,
+	Schools: 30 * time.Second,
 }
 
-// Info represents comprehensive information about a property
+// Info represents comprehensive information about a property. Sections that
+// could not be looked up are left empty and described in Errors; Schools is
+// then an empty list rather than nil. Sections served from expired cache
+// entries are listed in Warnings. Stages describes how each section was
+// answered; schools are absent if they were skipped.
 type Info struct {
-	Address     string      `json:"address"`
-	Coordinates Coordinates `json:"coordinates"`
-	Details     Details     `json:"details"`
-	Schools     []School    `json:"schools"`
+	Address     string                `json:"address"`
+	Coordinates *Coordinates          `json:"coordinates,omitempty"`
+	Details     *Details              `json:"details,omitempty"`
+	Schools     []School              `json:"schools"`
+	Errors      []SectionError        `json:"errors,omitempty"`
+	Warnings    []SectionError        `json:"warnings,omitempty"`
+	Stages      map[Section]StageInfo `json:"-"`
+}
+
+// CacheStatus describes how a lookup stage used the cache
+type CacheStatus string
+
+// Cache statuses
+const (
+	// CacheHit was answered from the in-memory or persistent cache
+	CacheHit CacheStatus = "hit"
+	// CacheMiss was fetched from the provider
+	CacheMiss CacheStatus = "miss"
+	// CacheCoalesced joined an identical lookup already in flight
+	CacheCoalesced CacheStatus = "coalesced"
+	// CacheStale was served from an expired entry while the provider's
+	// circuit breaker was open
+	CacheStale CacheStatus = "stale"
+)
+
+// StageInfo describes how one section of a lookup was answered. Duration is
+// the stage's total time, of which CacheTime was spent reading the cache and
+// Upstream waiting on the provider, including rate limiting and retries.
+type StageInfo struct {
+	Provider  string
+	Cache     CacheStatus
+	Duration  time.Duration
+	CacheTime time.Duration
+	Upstream  time.Duration
+}
+
+// recordUpstream notes a lookup sent upstream at start, possibly shared with
+// an identical one already in flight
+func (st *StageInfo) recordUpstream(start time.Time, shared bool) {
+	st.Upstream = time.Since(start)
+	st.Cache = CacheMiss
+	if shared {
+		st.Cache = CacheCoalesced
+	}
+}
+
+// Complete reports whether every section of the lookup succeeded
+func (i *Info) Complete() bool {
+	return len(i.Errors) == 0
+}
+
+func (i *Info) addError(section Section, err error) {
+	if err == nil {
+		return
+	}
+	i.Errors = append(i.Errors, SectionError{
+		Section: section,
+		Message: err.Error(),
+		Err:     err,
+	})
+}
+
+func (i *Info) addWarning(section Section, err error) {
+	if err == nil {
+		return
+	}
+	i.Warnings = append(i.Warnings, SectionError{
+		Section: section,
+		Message: "served stale data: " + err.Error(),
+		Err:     err,
+	})
+}
+
+// Section identifies one independently looked up part of an Info
+type Section string
+
+// Sections of an Info lookup
+const (
+	SectionGeocode Section = "geocode"
+	SectionDetails Section = "details"
+	SectionSchools Section = "schools"
+)
+
+var allSections = []Section{SectionGeocode, SectionDetails, SectionSchools}
+
+// errSkipped marks a section that was not attempted because a section it
+// depends on failed
+var errSkipped = errors.New("skipped: coordinates unavailable")
+
+// SectionError describes why one section of an Info could not be filled in
+type SectionError struct {
+	Section Section `json:"section"`
+	Message string  `json:"message"`
+	Err     error   `json:"-"`
+}
+
+func (e *SectionError) Error() string {
+	return fmt.Sprintf("%s failed: %s", e.Section, e.Message)
+}
+
+func (e *SectionError) Unwrap() error {
+	return e.Err
 }
 
 // Coordinates represents a geographical location
@@ -41,9 +204,10 @@ type School struct {
 	Type     string  `json:"type"`
 }
 
-// NewService creates a new instance of the property service
-func NewService() *Service {
-	return &Service{
+// NewService creates a new instance of the property service. Without options
+// it geocodes with Nominatim and reads the OpenCage key from OPENCAGE_API_KEY.
+func NewService(opts ...Option) *Service {
+	s := &Service{
 		httpClient: &http.Client{
 			Timeout: 60 * time.Second,
 			Transport: &http.Transport{
@@ -54,5 +218,140 @@ func NewService() *Service {
 				MaxIdleConnsPerHost: 30,
 			},
 		},
+		openCageURL:  opencage.DefaultBaseURL,
+		openCageKey:  os.Getenv("OPENCAGE_API_KEY"),
+		overpassURL:  DefaultOverpassURL,
+		schoolRadius: DefaultSchoolRadius,
+		timeouts:     DefaultTimeouts,
+		cacheConfig:  DefaultCacheConfig,
+		rateLimits:   maps.Clone(DefaultRateLimits),
+		retryPolicy:  DefaultRetryPolicy,
+		breakerCfg:   DefaultBreakerConfig,
+		logger:       slog.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// Every upstream request, including those made by the geocoder, goes
+	// through the retry policy and the per-host rate limiter, so that each
+	// retry also waits for its own token
+	base := s.httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if s.tracer != nil {
+		base = &tracingTransport{base: base, tracer: s.tracer}
+	}
+	s.limiter = newRateLimitedTransport(base, s.rateLimits)
+	if s.previous != nil {
+		s.limiter.adopt(s.previous.limiter)
+	}
+	client := *s.httpClient
+	client.Transport = newRetryTransport(s.limiter, s.retryPolicy, s.logger)
+	s.httpClient = &client
+
+	s.cache = newLookupCache(s.cacheConfig, s.store)
+	if s.previous != nil && s.previous.cacheConfig == s.cacheConfig && s.previous.store == s.store {
+		s.cache = s.previous.cache
+	}
+	s.openCage = &opencage.Client{
+		HTTPClient: s.httpClient,
+		BaseURL:    s.openCageURL,
+		APIKey:     s.openCageKey,
+	}
+
+	switch g := s.geocoder.(type) {
+	case nil:
+		s.geocoder = NewNominatimGeocoder(s.httpClient)
+	case *NominatimGeocoder:
+		if g.Client == nil {
+			g.Client = s.httpClient
+		}
+	case *OpenCageGeocoder:
+		if g.Client == nil {
+			g.Client = s.openCage
+		}
+	}
+
+	s.breakers = newBreakerSet(s.breakerCfg)
+	for _, provider := range []string{s.geocoder.Name(), ProviderOpenCage, ProviderOverpass} {
+		if s.previous != nil && s.previous.breakerCfg == s.breakerCfg && s.previous.endpoint(provider) == s.endpoint(provider) {
+			s.breakers.adopt(s.previous.breakers, provider)
+		}
+		s.breakers.get(provider)
+	}
+
+	// Let the previous service be collected once it is done
+	s.previous = nil
+	return s
+}
+
+// endpoint returns the URL requests to provider are sent to, or "" if it is
+// not known
+func (s *Service) endpoint(provider string) string {
+	switch provider {
+	case ProviderOpenCage:
+		return s.openCageURL
+	case ProviderOverpass:
+		return s.overpassURL
+	}
+	if g, ok := s.geocoder.(*NominatimGeocoder); ok && provider == g.Name() {
+		return g.BaseURL
+	}
+	return ""
+}
+
+// OpenCageQuota returns the OpenCage daily quota as of the last details
+// lookup. It reports false until a response has carried quota information,
+// or if the account has no daily limit.
+func (s *Service) OpenCageQuota() (opencage.Quota, bool) {
+	return s.openCage.Quota()
+}
+
+// Shutdown waits for upstream calls still running in the background to finish
+// and write their results to the cache, so that a Store can then be closed
+// safely. Callers must stop issuing lookups first. It returns ctx's error if
+// the calls outlast it.
+func (s *Service) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.flights.wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Breakers reports the circuit breaker state of each upstream provider
+func (s *Service) Breakers() map[string]BreakerStatus {
+	return s.breakers.status()
+}
+
+// Stats is a snapshot of the service's internal counters. Coalesced counts
+// the lookups that joined an identical request already in flight instead of
+// calling upstream. RateLimits is keyed by upstream host and Upstreams by
+// provider.
+type Stats struct {
+	Cache      map[Section]CacheStats    `json:"cache"`
+	Coalesced  map[Section]uint64        `json:"coalesced"`
+	RateLimits map[string]RateLimitStats `json:"rate_limits"`
+	Upstreams  map[string]UpstreamStats  `json:"upstreams"`
+}
+
+// Stats returns the current cache, coalescing, rate limiter and upstream
+// call counters
+func (s *Service) Stats() Stats {
+	return Stats{
+		Cache:      s.cache.stats(),
+		Coalesced:  s.flights.stats(),
+		RateLimits: s.limiter.stats(),
+		Upstreams:  s.upstreams.snapshot(),
 	}
 }
@@ -0,0 +1,103 @@
+package property
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the upstream latency histogram
+var LatencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// LatencyStats is a histogram of call durations. Counts[i] is the number of
+// calls slower than Buckets[i-1] that took at most Buckets[i]; calls slower
+// than the last bucket are only included in Count.
+type LatencyStats struct {
+	Buckets []time.Duration `json:"buckets"`
+	Counts  []uint64        `json:"counts"`
+	Count   uint64          `json:"count"`
+	Sum     time.Duration   `json:"sum"`
+}
+
+// UpstreamStats counts the lookups sent to one provider, including their
+// retries. Lookups rejected by an open circuit breaker are not counted, and
+// lookups abandoned by the caller are not errors.
+type UpstreamStats struct {
+	Calls   uint64       `json:"calls"`
+	Errors  uint64       `json:"errors"`
+	Latency LatencyStats `json:"latency"`
+}
+
+// upstreamStats tracks UpstreamStats per provider
+type upstreamStats struct {
+	mu        sync.Mutex
+	providers map[string]*UpstreamStats
+}
+
+func (u *upstreamStats) observe(provider string, duration time.Duration, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.providers == nil {
+		u.providers = make(map[string]*UpstreamStats)
+	}
+	stats, ok := u.providers[provider]
+	if !ok {
+		stats = &UpstreamStats{Latency: LatencyStats{
+			Buckets: LatencyBuckets,
+			Counts:  make([]uint64, len(LatencyBuckets)),
+		}}
+		u.providers[provider] = stats
+	}
+
+	stats.Calls++
+	if err != nil && !errors.Is(err, context.Canceled) {
+		stats.Errors++
+	}
+	i := sort.Search(len(LatencyBuckets), func(i int) bool { return duration <= LatencyBuckets[i] })
+	if i < len(LatencyBuckets) {
+		stats.Latency.Counts[i]++
+	}
+	stats.Latency.Count++
+	stats.Latency.Sum += duration
+}
+
+func (u *upstreamStats) snapshot() map[string]UpstreamStats {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	snapshot := make(map[string]UpstreamStats, len(u.providers))
+	for provider, stats := range u.providers {
+		s := *stats
+		s.Latency.Counts = slices.Clone(stats.Latency.Counts)
+		snapshot[provider] = s
+	}
+	return snapshot
+}
+
+// callUpstream runs fn through the provider's circuit breaker and records
+// the outcome
+func (s *Service) callUpstream(provider string, fn func() error) error {
+	start := time.Now()
+	err := s.breakers.call(provider, fn)
+	if !errors.Is(err, ErrCircuitOpen) {
+		s.upstreams.observe(provider, time.Since(start), err)
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package property
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUpstreamStats(t *testing.T) {
+	details := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"components": {}}], "status": {"code": 200}}`))
+	}))
+	defer details.Close()
+
+	schools := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	}))
+	defer schools.Close()
+
+	service := NewService(
+		WithGeocoder(&stubGeocoder{coords: &Coordinates{Lat: 37.7749, Lon: -122.4194}}),
+		WithOpenCageURL(details.URL),
+		WithOverpassURL(schools.URL),
+		WithRetryPolicy(RetryPolicy{}),
+		WithBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}),
+	)
+
+	service.GetInfo("123 Main St, San Francisco, CA 94105")
+	// Served from cache, or rejected by the open overpass breaker
+	service.GetInfo("123 Main St, San Francisco, CA 94105")
+
+	stats := service.Stats().Upstreams
+	tests := []struct {
+		provider   string
+		wantCalls  uint64
+		wantErrors uint64
+	}{
+		{provider: "stub", wantCalls: 1},
+		{provider: ProviderOpenCage, wantCalls: 1},
+		{provider: ProviderOverpass, wantCalls: 1, wantErrors: 1},
+	}
+
+	for _, tt := range tests {
+		got := stats[tt.provider]
+		if got.Calls != tt.wantCalls || got.Errors != tt.wantErrors {
+			t.Errorf("Stats().Upstreams[%s] = %d calls, %d errors, want %d, %d", tt.provider, got.Calls, got.Errors, tt.wantCalls, tt.wantErrors)
+		}
+		if got.Latency.Count != got.Calls || len(got.Latency.Counts) != len(LatencyBuckets) {
+			t.Errorf("Stats().Upstreams[%s].Latency = %+v, want one observation per call", tt.provider, got.Latency)
+		}
+	}
+}
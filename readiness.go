@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ssh-keyz/property-details/property"
+)
+
+// upstreamProbeTimeout bounds each round of upstream reachability probes
+const upstreamProbeTimeout = 5 * time.Second
+
+// Dependency check outcomes reported by /readyz
+const (
+	checkOK      = "ok"
+	checkFailed  = "fail"
+	checkUnknown = "unknown"
+)
+
+// dependencyStatus is the outcome of one readiness check
+type dependencyStatus struct {
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+func newDependencyStatus(err error, checkedAt time.Time) dependencyStatus {
+	status := dependencyStatus{Status: checkOK}
+	if !checkedAt.IsZero() {
+		status.CheckedAt = &checkedAt
+	}
+	if err != nil {
+		status.Status = checkFailed
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// readiness decides whether the service should receive traffic. The
+// configuration is checked on every call; upstream reachability, if enabled,
+// is probed in the background and the last results are served from memory so
+// that frequent readiness polls never reach the providers.
+type readiness struct {
+	service atomic.Pointer[property.Service]
+
+	mu        sync.RWMutex
+	probing   bool
+	upstreams map[string]error
+	checkedAt time.Time
+}
+
+func newReadiness(service *property.Service) *readiness {
+	r := &readiness{}
+	r.service.Store(service)
+	return r
+}
+
+// setService checks service from now on. Upstream results already probed are
+// kept until the next round.
+func (r *readiness) setService(service *property.Service) {
+	r.service.Store(service)
+}
+
+// run probes the upstream providers straight away and then every interval
+// until ctx is done. Until the first round completes the upstreams are
+// reported as unknown, which counts as not ready.
+func (r *readiness) run(ctx context.Context, interval time.Duration) {
+	r.mu.Lock()
+	r.probing = true
+	r.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh runs one round of upstream probes
+func (r *readiness) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, upstreamProbeTimeout)
+	defer cancel()
+
+	results := r.service.Load().ProbeUpstreams(ctx)
+	if ctx.Err() == context.Canceled {
+		return
+	}
+
+	r.mu.Lock()
+	r.upstreams = results
+	r.checkedAt = time.Now()
+	r.mu.Unlock()
+}
+
+// check reports whether every dependency is healthy, along with the status of
+// each: "config", then one entry per upstream provider while probing
+func (r *readiness) check() (bool, map[string]dependencyStatus) {
+	ready := true
+	checks := map[string]dependencyStatus{
+		"config": newDependencyStatus(r.service.Load().CheckConfig(), time.Time{}),
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	switch {
+	case !r.probing:
+	case r.checkedAt.IsZero():
+		ready = false
+		checks["upstreams"] = dependencyStatus{Status: checkUnknown}
+	default:
+		for provider, err := range r.upstreams {
+			checks[provider] = newDependencyStatus(err, r.checkedAt)
+		}
+	}
+
+	for _, status := range checks {
+		if status.Status != checkOK {
+			ready = false
+		}
+	}
+	return ready, checks
+}
+
+// readinessResponse is the /readyz body. Checks are only listed in verbose
+// mode.
+type readinessResponse struct {
+	Status string                      `json:"status"`
+	Checks map[string]dependencyStatus `json:"checks,omitempty"`
+}
+
+// handleLiveness reports that the process is up and serving requests. It
+// deliberately checks nothing else, so that an upstream outage never gets the
+// process restarted.
+func (s *Server) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeProblem(w, newProblem(http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": checkOK})
+}
+
+// handleReadiness answers 200 when every dependency check passes and 503
+// otherwise. With ?verbose=1 the status of each dependency is listed.
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeProblem(w, newProblem(http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	ready, checks := s.readiness.check()
+	response := readinessResponse{Status: "ready"}
+	status := http.StatusOK
+	if !ready {
+		response.Status = "not_ready"
+		status = http.StatusServiceUnavailable
+	}
+	if verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose")); verbose {
+		response.Checks = checks
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
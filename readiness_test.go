@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ssh-keyz/property-details/property"
+)
+
+func TestHandleLiveness(t *testing.T) {
+	server := &Server{}
+
+	w := httptest.NewRecorder()
+	server.handleLiveness(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("handleLiveness() status = %d, want 200", w.Code)
+	}
+}
+
+func TestHandleReadiness(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name       string
+		opts       []property.Option
+		probe      bool
+		wantStatus int
+		wantChecks map[string]string
+	}{
+		{
+			name:       "configured",
+			wantStatus: http.StatusOK,
+			wantChecks: map[string]string{"config": checkOK},
+		},
+		{
+			name:       "missing api key",
+			opts:       []property.Option{property.WithOpenCageAPIKey("")},
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"config": checkFailed},
+		},
+		{
+			name:       "upstreams reachable",
+			probe:      true,
+			wantStatus: http.StatusOK,
+			wantChecks: map[string]string{"config": checkOK, "nominatim": checkOK, "opencage": checkOK, "overpass": checkOK},
+		},
+		{
+			name:       "upstream down",
+			opts:       []property.Option{property.WithOverpassURL(down.URL)},
+			probe:      true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"config": checkOK, "nominatim": checkOK, "opencage": checkOK, "overpass": checkFailed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestService(t, tt.opts...)
+			server := &Server{service: service, readiness: newReadiness(service)}
+			if tt.probe {
+				server.readiness.probing = true
+				server.readiness.refresh(context.Background())
+			}
+
+			w := httptest.NewRecorder()
+			server.handleReadiness(w, httptest.NewRequest(http.MethodGet, "/readyz?verbose=1", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("handleReadiness() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			var response readinessResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(response.Checks) != len(tt.wantChecks) {
+				t.Errorf("checks = %+v, want %v", response.Checks, tt.wantChecks)
+			}
+			for name, want := range tt.wantChecks {
+				if got := response.Checks[name]; got.Status != want {
+					t.Errorf("checks[%s] = %+v, want %s", name, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("not ready until the first probe", func(t *testing.T) {
+		service := newTestService(t)
+		server := &Server{service: service, readiness: newReadiness(service)}
+		server.readiness.probing = true
+
+		w := httptest.NewRecorder()
+		server.handleReadiness(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("handleReadiness() status = %d, want 503", w.Code)
+		}
+		if body := w.Body.String(); body != "{\"status\":\"not_ready\"}\n" {
+			t.Errorf("handleReadiness() body = %s, want status only without ?verbose", body)
+		}
+	})
+}
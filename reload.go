@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ssh-keyz/property-details/config"
+	"github.com/ssh-keyz/property-details/property"
+	"github.com/ssh-keyz/property-details/tracing"
+)
+
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 2 * time.Second
+
+// generation is the Server built from one configuration, with its routes.
+// It counts the requests it is serving, so that once replaced it can tell
+// when the last of them has finished.
+type generation struct {
+	server  *Server
+	handler http.Handler
+
+	mu       sync.Mutex
+	requests int
+	retired  bool
+	drained  chan struct{} // closed once retired with no requests left
+}
+
+func newGeneration(server *Server) *generation {
+	return &generation{server: server, handler: server.routes(), drained: make(chan struct{})}
+}
+
+// acquire counts a request about to be served, unless the generation has
+// been retired
+func (g *generation) acquire() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.retired {
+		return false
+	}
+	g.requests++
+	return true
+}
+
+func (g *generation) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.requests--
+	if g.retired && g.requests == 0 {
+		close(g.drained)
+	}
+}
+
+func (g *generation) isDrained() bool {
+	select {
+	case <-g.drained:
+		return true
+	default:
+		return false
+	}
+}
+
+// retire stops the generation from taking new requests. The returned channel
+// is closed once those it was serving have finished.
+func (g *generation) retire() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.retired {
+		g.retired = true
+		if g.requests == 0 {
+			close(g.drained)
+		}
+	}
+	return g.drained
+}
+
+// liveServer serves each request with the Server built from the current
+// configuration. A reload builds a new Server and swaps it in atomically;
+// requests already being served finish with the one they started on.
+// Metrics, readiness and the tracer outlive reloads.
+type liveServer struct {
+	logger    *slog.Logger
+	tracer    *tracing.Tracer
+	metrics   *serverMetrics
+	readiness *readiness
+	load      func() (*config.Config, error)
+	// options are given to every property service built, after those
+	// derived from the configuration
+	options []property.Option
+
+	current atomic.Pointer[generation]
+
+	mu sync.Mutex // serialises reloads
+	// generations holds every generation built around the current service
+	generations []*generation
+	// services holds the current service and those replaced by a reload
+	// that may still be serving requests or running background lookups.
+	// A replaced service is dropped once it has finished.
+	services []*property.Service
+}
+
+func newLiveServer(cfg *config.Config, load func() (*config.Config, error), logger *slog.Logger, tracer *tracing.Tracer, options []property.Option) (*liveServer, error) {
+	l := &liveServer{
+		logger:  logger,
+		tracer:  tracer,
+		load:    load,
+		options: options,
+	}
+
+	service, err := l.newService(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	l.services = append(l.services, service)
+	l.metrics = newServerMetrics(service)
+	l.readiness = newReadiness(service)
+	l.install(cfg, service)
+	return l, nil
+}
+
+// newService builds a property service configured by cfg, taking over the
+// cache, circuit breakers and rate limiters of previous, if any
+func (l *liveServer) newService(cfg *config.Config, previous *property.Service) (*property.Service, error) {
+	geocoder, err := newGeocoder(cfg.Geocoder, cfg.Upstreams.NominatimURL)
+	if err != nil {
+		return nil, err
+	}
+	opts := serviceOptions(cfg, geocoder)
+	if previous != nil {
+		opts = append(opts, property.WithStateFrom(previous))
+	}
+	return property.NewService(append(opts, l.options...)...), nil
+}
+
+// install makes a Server for cfg and service the one serving new requests.
+// The generation it replaces is retired; if that used another service, the
+// service is too. Callers must hold mu, except while the liveServer is being
+// built.
+func (l *liveServer) install(cfg *config.Config, service *property.Service) {
+	server := &Server{
+		service:   service,
+		logger:    l.logger,
+		metrics:   l.metrics,
+		tracer:    l.tracer,
+		readiness: l.readiness,
+		config:    cfg,
+	}
+	gen := newGeneration(server)
+	previous := l.current.Swap(gen)
+	switch {
+	case previous == nil:
+	case previous.server.service == service:
+		previous.retire()
+	default:
+		go l.retire(previous.server.service, l.generations)
+		l.generations = nil
+	}
+	// Forget the generations that have finished while the service is kept
+	l.generations = append(slices.DeleteFunc(l.generations, (*generation).isDrained), gen)
+}
+
+func (l *liveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// A reload may retire the generation between loading and acquiring it
+	for {
+		gen := l.current.Load()
+		if gen.acquire() {
+			defer gen.release()
+			gen.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+}
+
+// reload loads the configuration again and swaps it in. An invalid
+// configuration is rejected and the current one stays live. The property
+// service is only rebuilt if its own settings changed, and then keeps the
+// caches, circuit breakers and rate limiters of the one it replaces.
+func (l *liveServer) reload(trigger string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	logger := l.logger.With("trigger", trigger)
+	current := l.current.Load().server
+
+	cfg, err := l.load()
+	if err != nil {
+		logger.Error("Rejected configuration reload; keeping the current configuration", "error", err)
+		return
+	}
+	if pending := keepRestartOnly(current.config, cfg); len(pending) > 0 {
+		logger.Warn("Configuration changes need a restart to take effect", "sections", pending)
+	}
+
+	service := current.service
+	rebuilt := serviceChanged(current.config, cfg)
+	if rebuilt {
+		if service, err = l.newService(cfg, current.service); err != nil {
+			logger.Error("Rejected configuration reload; keeping the current configuration", "error", err)
+			return
+		}
+		l.services = append(l.services, service)
+		l.metrics.setService(service)
+		l.readiness.setService(service)
+	}
+
+	l.install(cfg, service)
+	logger.Info("Reloaded configuration", "service_rebuilt", rebuilt)
+}
+
+// retire waits for the requests served by generations, every one built
+// around service, and then for service's background lookups to finish,
+// before dropping it
+func (l *liveServer) retire(service *property.Service, generations []*generation) {
+	for _, gen := range generations {
+		<-gen.retire()
+	}
+	service.Shutdown(context.Background())
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.services = slices.DeleteFunc(l.services, func(s *property.Service) bool { return s == service })
+}
+
+// serviceChanged reports whether the property service must be rebuilt to
+// apply next
+func serviceChanged(current, next *config.Config) bool {
+	return current.Geocoder != next.Geocoder ||
+		current.Upstreams != next.Upstreams ||
+		current.Schools != next.Schools ||
+		current.RateLimits != next.RateLimits
+}
+
+// keepRestartOnly resets the sections of next that cannot change while the
+// server runs to their current values, so that the configuration reported
+// stays the one in effect. It returns the names of the sections that differed.
+func keepRestartOnly(current, next *config.Config) []string {
+	var pending []string
+	if next.Server != current.Server {
+		pending = append(pending, "server")
+		next.Server = current.Server
+	}
+	if next.Log != current.Log {
+		pending = append(pending, "log")
+		next.Log = current.Log
+	}
+	if next.Cache != current.Cache {
+		pending = append(pending, "cache")
+		next.Cache = current.Cache
+	}
+	if next.Tracing != current.Tracing {
+		pending = append(pending, "tracing")
+		next.Tracing = current.Tracing
+	}
+	if next.Readiness != current.Readiness {
+		pending = append(pending, "readiness")
+		next.Readiness = current.Readiness
+	}
+	return pending
+}
+
+// watch reloads the configuration on each signal from hup, and whenever the
+// config file at path, if any, is seen to change when polled every interval,
+// until ctx is done
+func (l *liveServer) watch(ctx context.Context, path string, interval time.Duration, hup <-chan os.Signal) {
+	var poll <-chan time.Time
+	var last os.FileInfo
+	if path != "" {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+		last, _ = os.Stat(path)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			l.reload("SIGHUP")
+		case <-poll:
+			// A file being replaced may briefly be missing
+			info, err := os.Stat(path)
+			if err != nil || (last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size()) {
+				continue
+			}
+			last = info
+			l.reload("file")
+		}
+	}
+}
+
+// shutdown waits for the background lookups of the current service, and of
+// any replaced ones not yet dropped, to finish, or returns ctx's error
+func (l *liveServer) shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, service := range l.services {
+		if err := service.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
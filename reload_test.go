@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ssh-keyz/property-details/config"
+)
+
+// syncBuffer collects log output written from several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newTestLiveServer serves the configuration in a YAML file, which the test
+// rewrites with the returned function
+func newTestLiveServer(t *testing.T, content string, logs io.Writer) (*liveServer, string, func(string)) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(content)
+
+	load := func() (*config.Config, error) {
+		return config.Load([]string{"-config", path}, func(string) string { return "" })
+	}
+	cfg, err := load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	live, err := newLiveServer(cfg, load, slog.New(slog.NewTextHandler(logs, nil)), nil, nil)
+	if err != nil {
+		t.Fatalf("newLiveServer() error = %v", err)
+	}
+	return live, path, write
+}
+
+// allowsOrigin reports whether a preflight from origin is accepted
+func allowsOrigin(handler http.Handler, origin string) bool {
+	req := httptest.NewRequest(http.MethodOptions, "/property", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Header().Get("Access-Control-Allow-Origin") == origin
+}
+
+func TestLiveServerReload(t *testing.T) {
+	var logs syncBuffer
+	live, _, write := newTestLiveServer(t, "cors:\n  allowed_origins: [https://a.example.com]\n", &logs)
+	service := live.current.Load().server.service
+
+	if !allowsOrigin(live, "https://a.example.com") {
+		t.Fatal("initial configuration does not allow https://a.example.com")
+	}
+
+	// CORS changes keep the property service and its caches
+	write("cors:\n  allowed_origins: [https://b.example.com]\n")
+	live.reload("test")
+	if allowsOrigin(live, "https://a.example.com") || !allowsOrigin(live, "https://b.example.com") {
+		t.Error("reload did not swap in the new CORS origins")
+	}
+	if live.current.Load().server.service != service {
+		t.Error("reload rebuilt the service, want it kept when only CORS changed")
+	}
+
+	// Service settings rebuild it
+	write("cors:\n  allowed_origins: [https://b.example.com]\nschools:\n  radius_m: 500\n")
+	live.reload("test")
+	rebuilt := live.current.Load().server.service
+	if rebuilt == service {
+		t.Error("reload kept the service, want it rebuilt for a new school radius")
+	}
+	if live.metrics.service.Load() != rebuilt || live.readiness.service.Load() != rebuilt {
+		t.Error("metrics and readiness still report the replaced service")
+	}
+	// With no requests or lookups left, the replaced service is dropped
+	deadline := time.Now().Add(2 * time.Second)
+	for services := 2; services != 1; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("services = %d, want the replaced one dropped", services)
+		}
+		live.mu.Lock()
+		services = len(live.services)
+		live.mu.Unlock()
+	}
+
+	// Invalid configurations leave the current one live
+	write("cors:\n  allowed_origins: [b.example.com]\n")
+	live.reload("test")
+	if !allowsOrigin(live, "https://b.example.com") {
+		t.Error("rejected reload changed the CORS origins")
+	}
+	if !strings.Contains(logs.String(), "Rejected configuration reload") {
+		t.Errorf("logs = %s, want the rejection logged", logs.String())
+	}
+
+	// Settings that need a restart keep their current values
+	write("cors:\n  allowed_origins: [https://b.example.com]\nschools:\n  radius_m: 500\nserver:\n  addr: \":9999\"\n")
+	live.reload("test")
+	if addr := live.current.Load().server.config.Server.Addr; addr != ":8080" {
+		t.Errorf("Server.Addr = %q, want the address in use kept", addr)
+	}
+	if !strings.Contains(logs.String(), "need a restart") {
+		t.Errorf("logs = %s, want the pending restart logged", logs.String())
+	}
+
+	if got := strings.Count(logs.String(), "Reloaded configuration"); got != 3 {
+		t.Errorf("logged %d reloads, want 3", got)
+	}
+	if err := live.shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+}
+
+func TestGenerationRetire(t *testing.T) {
+	gen := newGeneration(&Server{service: newTestService(t), metrics: newServerMetrics(nil), config: config.Default()})
+
+	if !gen.acquire() {
+		t.Fatal("acquire() = false, want a live generation to take requests")
+	}
+	drained := gen.retire()
+	if gen.acquire() {
+		t.Error("acquire() = true, want a retired generation to refuse requests")
+	}
+	select {
+	case <-drained:
+		t.Fatal("drained before its request finished")
+	default:
+	}
+
+	gen.release()
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("not drained after its last request finished")
+	}
+	if !gen.isDrained() {
+		t.Error("isDrained() = false after draining")
+	}
+}
+
+func TestLiveServerWatch(t *testing.T) {
+	live, path, write := newTestLiveServer(t, "cors:\n  allowed_origins: [https://a.example.com]\n", io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hup := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		live.watch(ctx, path, 10*time.Millisecond, hup)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitForOrigin := func(t *testing.T, origin string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !allowsOrigin(live, origin) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s never allowed", origin)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("SIGHUP", func(t *testing.T) {
+		// Keep the size and timestamp, which the poll alone would miss. Once
+		// handled, the watcher is known to have taken its first look at the file.
+		info, _ := os.Stat(path)
+		write("cors:\n  allowed_origins: [https://c.example.com]\n")
+		os.Chtimes(path, info.ModTime(), info.ModTime())
+		hup <- syscall.SIGHUP
+		waitForOrigin(t, "https://c.example.com")
+	})
+
+	t.Run("file change", func(t *testing.T) {
+		write("cors:\n  allowed_origins: [https://d.example.com]\n")
+		// Make the change visible on filesystems with coarse timestamps
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(path, later, later)
+		waitForOrigin(t, "https://d.example.com")
+	})
+}
+
+func TestServiceChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*config.Config)
+		want   bool
+	}{
+		{name: "nothing", change: func(*config.Config) {}},
+		{name: "cors", change: func(c *config.Config) { c.CORS.AllowedOrigins = nil }},
+		{name: "batch", change: func(c *config.Config) { c.Batch.Concurrency++ }},
+		{name: "geocoder", change: func(c *config.Config) { c.Geocoder = "opencage" }, want: true},
+		{name: "upstreams", change: func(c *config.Config) { c.Upstreams.Timeout = 0 }, want: true},
+		{name: "schools", change: func(c *config.Config) { c.Schools.RadiusMetres++ }, want: true},
+		{name: "rate limits", change: func(c *config.Config) { c.RateLimits.Overpass.Burst++ }, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := config.Default()
+			tt.change(next)
+			if got := serviceChanged(config.Default(), next); got != tt.want {
+				t.Errorf("serviceChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ssh-keyz/property-details/config"
+)
+
+// startServe runs serve on a local port with handler, returning its address
+// and the channel serve's result is sent on
+func startServe(t *testing.T, ctx context.Context, handler http.Handler, shutdownTimeout time.Duration) (string, <-chan error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := newHTTPServer(config.Default().Server, handler, logger)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve(ctx, srv, ln, shutdownTimeout, logger)
+	}()
+	return "http://" + ln.Addr().String(), errc
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, errc := startServe(t, ctx, handler, 5*time.Second)
+
+	type result struct {
+		body string
+		err  error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(addr)
+		if err != nil {
+			resc <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		resc <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	// Shutdown stops accepting new connections straight away
+	time.Sleep(50 * time.Millisecond)
+	if resp, err := http.Get(addr); err == nil {
+		resp.Body.Close()
+		t.Error("request after shutdown began succeeded, want connection refused")
+	}
+
+	close(release)
+	if res := <-resc; res.err != nil || res.body != "done" {
+		t.Errorf("in-flight request = %q, %v, want it to complete", res.body, res.err)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("serve() error = %v, want nil after a clean drain", err)
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, errc := startServe(t, ctx, handler, 50*time.Millisecond)
+
+	go func() {
+		if resp, err := http.Get(addr); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("serve() error = nil, want the shutdown timeout")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve() did not give up on a request that never finishes")
+	}
+}
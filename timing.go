@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ssh-keyz/property-details/property"
+)
+
+// serverTimingSections lists the stages reported in Server-Timing, in order
+var serverTimingSections = []property.Section{
+	property.SectionGeocode,
+	property.SectionDetails,
+	property.SectionSchools,
+}
+
+// serverTiming formats a Server-Timing header breaking a lookup down into its
+// stages, the time spent reading the cache across all of them and the total
+func serverTiming(info *property.Info, total time.Duration) string {
+	var metrics []string
+	var cacheTime time.Duration
+	for _, section := range serverTimingSections {
+		stage, ok := info.Stages[section]
+		if !ok {
+			continue
+		}
+		cacheTime += stage.CacheTime
+		desc := strings.TrimSpace(stage.Provider + " " + string(stage.Cache))
+		metrics = append(metrics, fmt.Sprintf("%s;dur=%s;desc=%q", section, formatMillis(stage.Duration), desc))
+	}
+	metrics = append(metrics,
+		"cache;dur="+formatMillis(cacheTime),
+		"total;dur="+formatMillis(total),
+	)
+	return strings.Join(metrics, ", ")
+}
+
+// debugInfo is the debug block added to a /property response with ?debug=1
+type debugInfo struct {
+	Sections map[property.Section]debugStage `json:"sections"`
+	TotalMS  float64                         `json:"total_ms"`
+}
+
+// debugStage describes how one section was answered. UpstreamMS is the time
+// spent waiting on the provider, including rate limiting and retries.
+type debugStage struct {
+	Provider   string               `json:"provider"`
+	Cache      property.CacheStatus `json:"cache"`
+	DurationMS float64              `json:"duration_ms"`
+	CacheMS    float64              `json:"cache_ms"`
+	UpstreamMS float64              `json:"upstream_ms"`
+}
+
+func newDebugInfo(info *property.Info, total time.Duration) *debugInfo {
+	debug := &debugInfo{
+		Sections: make(map[property.Section]debugStage, len(info.Stages)),
+		TotalMS:  millis(total),
+	}
+	for section, stage := range info.Stages {
+		debug.Sections[section] = debugStage{
+			Provider:   stage.Provider,
+			Cache:      stage.Cache,
+			DurationMS: millis(stage.Duration),
+			CacheMS:    millis(stage.CacheTime),
+			UpstreamMS: millis(stage.Upstream),
+		}
+	}
+	return debug
+}
+
+// debugRequested reports whether the client asked for the debug block
+func debugRequested(r *http.Request) bool {
+	debug, _ := strconv.ParseBool(r.URL.Query().Get("debug"))
+	return debug
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func formatMillis(d time.Duration) string {
+	return strconv.FormatFloat(millis(d), 'f', 1, 64)
+}
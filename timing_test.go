@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssh-keyz/property-details/property"
+)
+
+func TestServerTiming(t *testing.T) {
+	info := &property.Info{
+		Stages: map[property.Section]property.StageInfo{
+			property.SectionGeocode: {Provider: "nominatim", Cache: property.CacheHit, Duration: 1500 * time.Microsecond, CacheTime: 500 * time.Microsecond},
+			property.SectionDetails: {Provider: "opencage", Cache: property.CacheMiss, Duration: 120 * time.Millisecond, CacheTime: 250 * time.Microsecond, Upstream: 119 * time.Millisecond},
+		},
+	}
+
+	want := `geocode;dur=1.5;desc="nominatim hit", details;dur=120.0;desc="opencage miss", cache;dur=0.8, total;dur=125.0`
+	if got := serverTiming(info, 125*time.Millisecond); got != want {
+		t.Errorf("serverTiming() = %s, want %s", got, want)
+	}
+}
+
+func TestHandleGetPropertyTiming(t *testing.T) {
+	server := &Server{service: newTestService(t)}
+	address := url.QueryEscape("1600 Amphitheatre Parkway, Mountain View, CA 94043")
+
+	t.Run("server timing header", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.handleGetProperty(w, httptest.NewRequest(http.MethodGet, "/property?address="+address, nil))
+
+		header := w.Header().Get("Server-Timing")
+		for _, metric := range []string{"geocode;", "details;", "schools;", "cache;", "total;"} {
+			if !strings.Contains(header, metric) {
+				t.Errorf("Server-Timing = %q, want %s metric", header, strings.TrimSuffix(metric, ";"))
+			}
+		}
+
+		var body map[string]any
+		json.NewDecoder(w.Body).Decode(&body)
+		if _, ok := body["debug"]; ok {
+			t.Errorf("response = %v, want no debug block without ?debug=1", body)
+		}
+	})
+
+	t.Run("debug block", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.handleGetProperty(w, httptest.NewRequest(http.MethodGet, "/property?debug=1&address="+address, nil))
+
+		var body struct {
+			Address string     `json:"address"`
+			Debug   *debugInfo `json:"debug"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if body.Address == "" || body.Debug == nil {
+			t.Fatalf("response = %+v, want the property with a debug block", body)
+		}
+
+		// The first request above populated the cache
+		for section, provider := range map[property.Section]string{
+			property.SectionGeocode: property.ProviderNominatim,
+			property.SectionDetails: property.ProviderOpenCage,
+			property.SectionSchools: property.ProviderOverpass,
+		} {
+			stage := body.Debug.Sections[section]
+			if stage.Provider != provider || stage.Cache != property.CacheHit {
+				t.Errorf("debug.sections[%s] = %+v, want a %s cache hit", section, stage, provider)
+			}
+		}
+		if body.Debug.TotalMS <= 0 {
+			t.Errorf("debug.total_ms = %v, want positive", body.Debug.TotalMS)
+		}
+	})
+}
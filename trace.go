@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/ssh-keyz/property-details/tracing"
+)
+
+// newTracer selects the span exporter named by the tracing.exporter setting:
+// none (the default), stdout, or file, which appends to path, the
+// tracing.file setting. The returned closer must be closed on shutdown.
+func newTracer(exporter, path string) (*tracing.Tracer, io.Closer, error) {
+	switch exporter {
+	case "", "none":
+		return nil, io.NopCloser(nil), nil
+	case "stdout":
+		return tracing.NewTracer(tracing.NewWriterExporter(os.Stdout)), io.NopCloser(nil), nil
+	case "file":
+		if path == "" {
+			return nil, nil, fmt.Errorf("tracing.file is required by the file exporter")
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		return tracing.NewTracer(tracing.NewWriterExporter(f)), f, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+}
+
+// traceRoute records a server span for each request to route, continuing
+// the caller's trace if the request carries a valid traceparent header
+func (s *Server) traceRoute(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if parent, ok := tracing.Extract(r.Header); ok {
+			ctx = tracing.ContextWithRemoteParent(ctx, parent)
+		}
+
+		ctx, span := s.tracer.Start(ctx, r.Method+" "+route)
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r.WithContext(ctx))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttribute("http.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("handler returned %d", status))
+		}
+	}
+}
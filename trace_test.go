@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ssh-keyz/property-details/property"
+	"github.com/ssh-keyz/property-details/tracing"
+)
+
+func TestTraceRoute(t *testing.T) {
+	recorder := &tracing.Recorder{}
+	tracer := tracing.NewTracer(recorder)
+	server := &Server{
+		service: newTestService(t, property.WithTracer(tracer)),
+		tracer:  tracer,
+	}
+	handler := server.traceRoute("/property", server.handleGetProperty)
+
+	address := "1600 Amphitheatre Parkway, Mountain View, CA 94043"
+	req := httptest.NewRequest(http.MethodGet, "/property?address="+url.QueryEscape(address), nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler(httptest.NewRecorder(), req)
+
+	var handlerSpan, getInfo tracing.SpanData
+	for _, span := range recorder.Spans() {
+		if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("span %s is in trace %s, want the caller's", span.Name, span.TraceID)
+		}
+		switch span.Name {
+		case "GET /property":
+			handlerSpan = span
+		case "property.GetInfo":
+			getInfo = span
+		}
+	}
+
+	if handlerSpan.ParentSpanID != "00f067aa0ba902b7" || handlerSpan.Attributes["http.status_code"] != http.StatusOK {
+		t.Errorf("handler span = %+v, want a successful child of the caller's span", handlerSpan)
+	}
+	if getInfo.ParentSpanID != handlerSpan.SpanID {
+		t.Errorf("GetInfo span = %+v, want a child of the handler span", getInfo)
+	}
+}
+
+func TestNewTracer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+
+	tests := []struct {
+		name       string
+		exporter   string
+		path       string
+		wantTracer bool
+		wantErr    bool
+	}{
+		{name: "default", exporter: ""},
+		{name: "none", exporter: "none"},
+		{name: "stdout", exporter: "stdout", wantTracer: true},
+		{name: "file", exporter: "file", path: path, wantTracer: true},
+		{name: "file without path", exporter: "file", wantErr: true},
+		{name: "unknown", exporter: "jaeger", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer, closer, err := newTracer(tt.exporter, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTracer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer closer.Close()
+
+			if (tracer != nil) != tt.wantTracer {
+				t.Errorf("newTracer() = %v, want tracer %v", tracer, tt.wantTracer)
+			}
+		})
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file exporter did not create %s: %v", path, err)
+	}
+}
@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// WriterExporter writes each span as a line of JSON, for exporting to
+// stdout or a file during local development
+type WriterExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriterExporter creates an exporter that writes to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+// Export implements Exporter. Write errors are dropped, since losing a span
+// must not fail the request that produced it.
+func (e *WriterExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.enc.Encode(span)
+}
+
+// Recorder keeps finished spans in memory, for tests
+type Recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// Export implements Exporter
+func (r *Recorder) Export(span SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.spans = append(r.spans, span)
+}
+
+// Spans returns the spans exported so far, in the order they ended
+func (r *Recorder) Spans() []SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spans := make([]SpanData, len(r.spans))
+	copy(spans, r.spans)
+	return spans
+}
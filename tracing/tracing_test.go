@@ -0,0 +1,144 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		wantOK      bool
+		wantSampled bool
+	}{
+		{name: "sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantOK: true, wantSampled: true},
+		{name: "not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", wantOK: true},
+		{name: "future version", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantOK: true, wantSampled: true},
+		{name: "empty", value: ""},
+		{name: "invalid version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "extra fields in version 00", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{name: "zero trace id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "zero span id", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "uppercase", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"},
+		{name: "short trace id", value: "00-4bf92f3577b34da6-00f067aa0ba902b7-01"},
+		{name: "not hex", value: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.value)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseTraceparent(%q) ok = %v, want %v", tt.value, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if sc.Sampled != tt.wantSampled {
+				t.Errorf("ParseTraceparent(%q).Sampled = %v, want %v", tt.value, sc.Sampled, tt.wantSampled)
+			}
+			if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+				t.Errorf("ParseTraceparent(%q) = %+v", tt.value, sc)
+			}
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	t.Run("children share the trace", func(t *testing.T) {
+		recorder := &Recorder{}
+		tracer := NewTracer(recorder)
+
+		ctx, root := tracer.Start(context.Background(), "root")
+		_, child := tracer.Start(ctx, "child")
+		child.SetAttribute("count", 3)
+		child.RecordError(errors.New("boom"))
+		child.End()
+		root.End()
+		root.End()
+
+		spans := recorder.Spans()
+		if len(spans) != 2 {
+			t.Fatalf("Spans() = %+v, want 2 spans", spans)
+		}
+		if spans[0].Name != "child" || spans[0].TraceID != spans[1].TraceID || spans[0].ParentSpanID != spans[1].SpanID {
+			t.Errorf("child span = %+v, want a child of %+v", spans[0], spans[1])
+		}
+		if spans[0].Attributes["count"] != 3 || spans[0].Error != "boom" {
+			t.Errorf("child span = %+v, want count attribute and error", spans[0])
+		}
+		if spans[1].ParentSpanID != "" {
+			t.Errorf("root span parent = %q, want none", spans[1].ParentSpanID)
+		}
+	})
+
+	t.Run("continues a remote trace", func(t *testing.T) {
+		recorder := &Recorder{}
+		remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		ctx := ContextWithRemoteParent(context.Background(), remote)
+		ctx, span := NewTracer(recorder).Start(ctx, "server")
+
+		header := http.Header{}
+		Inject(ctx, header)
+		span.End()
+
+		got := recorder.Spans()[0]
+		if got.TraceID != remote.TraceID.String() || got.ParentSpanID != remote.SpanID.String() {
+			t.Errorf("span = %+v, want a child of %s", got, remote.Traceparent())
+		}
+		if want := "00-" + got.TraceID + "-" + got.SpanID + "-01"; header.Get(TraceparentHeader) != want {
+			t.Errorf("injected traceparent = %q, want %q", header.Get(TraceparentHeader), want)
+		}
+	})
+
+	t.Run("unsampled traces are not exported", func(t *testing.T) {
+		recorder := &Recorder{}
+		remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+
+		ctx := ContextWithRemoteParent(context.Background(), remote)
+		_, span := NewTracer(recorder).Start(ctx, "server")
+		span.End()
+
+		if spans := recorder.Spans(); len(spans) != 0 {
+			t.Errorf("Spans() = %+v, want none", spans)
+		}
+	})
+
+	t.Run("nil tracer records nothing", func(t *testing.T) {
+		var tracer *Tracer
+		ctx, span := tracer.Start(context.Background(), "noop")
+		span.SetAttribute("key", "value")
+		span.RecordError(errors.New("boom"))
+		span.End()
+
+		if SpanFromContext(ctx) != nil {
+			t.Error("nil tracer added a span to the context")
+		}
+
+		header := http.Header{}
+		Inject(ctx, header)
+		if header.Get(TraceparentHeader) != "" {
+			t.Errorf("injected traceparent = %q, want none", header.Get(TraceparentHeader))
+		}
+	})
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	_, span := NewTracer(NewWriterExporter(&buf)).Start(context.Background(), "op")
+	span.SetAttribute("provider", "overpass")
+	span.End()
+
+	var got SpanData
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("exported %q, want JSON: %v", buf.String(), err)
+	}
+	if got.Name != "op" || got.Attributes["provider"] != "overpass" || got.End.Before(got.Start) {
+		t.Errorf("exported span = %+v", got)
+	}
+}